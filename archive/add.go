@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Add 将 sources 中的文件或文件夹追加到已有的 ZIP 文件 target，每个源的条目以其 basename 为前缀
+// 已有条目以原始数据直接复制，不重新压缩；新条目与已有条目同名时，设置了 opts.Replace 则替换已有条目，
+// 否则报错。同名的目录条目不算冲突，保留已有的目录条目。归档注释和条目注释随之保留
+func Add(target string, sources []string, opts Options) (*Result, error) {
+	// 追加的条目名由源的 basename 决定，不加前缀
+	opts.Prefix = ""
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("没有指定要追加的文件")
+	}
+
+	level, err := opts.flateLevel()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := opts.zipMethod(); err != nil {
+		return nil, err
+	}
+
+	prefixes, err := basenamePrefixes(sources)
+	if err != nil {
+		return nil, err
+	}
+	opts.addOutput(target)
+
+	reader, err := OpenZip(target)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	if reader.Split {
+		return nil, fmt.Errorf("不能向分卷归档追加文件: %s", target)
+	}
+
+	existing := make(map[string]bool)
+	existingDirs := make(map[string]bool)
+	for _, file := range reader.File {
+		existing[file.Name] = true
+		if strings.HasSuffix(file.Name, "/") {
+			existingDirs[file.Name] = true
+		}
+	}
+
+	// 先遍历一遍源，找出会替换的已有条目
+	replaced := make(map[string]bool)
+	for i, source := range sources {
+		err := walkSource(source, prefixes[i], opts, nil, func(path, name string, info os.FileInfo) error {
+			name = filepath.ToSlash(name)
+			if info.IsDir() || !existing[name] {
+				return nil
+			}
+			if !opts.Replace {
+				return fmt.Errorf("归档中已存在条目: %s", name)
+			}
+			replaced[name] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 新归档沿用原归档的权限
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeFileAtomic(target, opts.TempDir, info.Mode().Perm(), func(file *os.File) (result *Result, err error) {
+		opts.addOutput(file.Name())
+		c := newCompressor(file, level, opts)
+		defer closeWith(c.archive, &err)
+
+		comment := reader.Comment
+		if opts.Comment != "" {
+			comment = opts.Comment
+		}
+		if err := c.archive.SetComment(comment); err != nil {
+			return nil, err
+		}
+
+		for _, file := range reader.File {
+			if replaced[file.Name] {
+				opts.verbosef("  替换: %s\n", file.Name)
+				continue
+			}
+			if err := c.archive.Copy(file); err != nil {
+				return nil, err
+			}
+		}
+
+		c.existingDirs = existingDirs
+		return c.addSources(sources, prefixes)
+	})
+}
@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddKeepsArchiveMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不区分这些权限位")
+	}
+	dir := t.TempDir()
+	files := sampleFiles()
+	source := writeTestTree(t, filepath.Join(dir, "src"), files)
+	target := filepath.Join(dir, "out.zip")
+	if _, err := Compress([]string{source}, target, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(target, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	extra := writeTestTree(t, filepath.Join(dir, "extra"), map[string]string{"new.txt": "new"})
+	if _, err := Add(target, []string{extra}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("追加后归档权限应保持 0600，实际 %v", info.Mode().Perm())
+	}
+}
+
+// 原始压缩数据
+func rawData(t *testing.T, file *zip.File) string {
+	t.Helper()
+	r, err := file.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// 已有条目按原始数据复制：压缩方法、CRC、修改时间和压缩后的字节都不变
+func TestAddCopiesExistingEntries(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out.zip")
+	file, err := os.Create(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2020, 5, 6, 7, 8, 10, 0, time.UTC)
+	w := zip.NewWriter(file)
+	for _, header := range []*zip.FileHeader{
+		{Name: "stored.txt", Method: zip.Store, Modified: modified},
+		{Name: "deflated.txt", Method: zip.Deflate, Modified: modified},
+	} {
+		writer, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(strings.Repeat(header.Name, 100))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := make(map[string]*zip.File)
+	raw := make(map[string]string)
+	reader, err := OpenZip(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range reader.File {
+		before[file.Name] = file
+		raw[file.Name] = rawData(t, file)
+	}
+	reader.Close()
+
+	extra := filepath.Join(dir, "new.txt")
+	if err := ioutil.WriteFile(extra, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 以不同的压缩级别追加，已有条目也不应重新压缩
+	if _, err := Add(target, []string{extra}, Options{Level: 9}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err = OpenZip(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	found := 0
+	for _, file := range reader.File {
+		old, ok := before[file.Name]
+		if !ok {
+			continue
+		}
+		found++
+		if file.Method != old.Method || file.CRC32 != old.CRC32 || !file.Modified.Equal(old.Modified) ||
+			file.CompressedSize64 != old.CompressedSize64 {
+			t.Errorf("%s 的条目头被改动: method %d->%d crc %x->%x", file.Name, old.Method, file.Method, old.CRC32, file.CRC32)
+		}
+		if rawData(t, file) != raw[file.Name] {
+			t.Errorf("%s 的压缩数据被改动", file.Name)
+		}
+	}
+	if found != len(before) {
+		t.Fatalf("追加后缺少原有条目: %d/%d", found, len(before))
+	}
+}
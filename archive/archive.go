@@ -0,0 +1,604 @@
+// Package archive 提供 xzip 的压缩与解压功能，可被其他 Go 程序直接调用。
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LevelDefault 使用 Deflate 的默认压缩级别（Options 的零值）
+	LevelDefault = 0
+	// LevelStore 仅存储，不压缩
+	LevelStore = -1
+
+	// DefaultBufferSize 复制文件内容时默认的缓冲区大小
+	// 比 io.Copy 的 32 KiB 大，减少大文件读写的系统调用次数
+	DefaultBufferSize = 256 << 10
+
+	// DefaultMaxEntries 解压时默认最多处理的条目数
+	DefaultMaxEntries = 1000000
+	// DefaultMaxTotalSize 解压时默认允许解压出的内容总字节数
+	DefaultMaxTotalSize = 64 << 30
+)
+
+// 归档格式
+const (
+	// FormatZip ZIP 格式（Options 的零值）
+	FormatZip = "zip"
+	// FormatTarGz gzip 压缩的 tar 格式
+	FormatTarGz = "targz"
+)
+
+// ZIP 条目的压缩方法
+const (
+	// MethodDeflate Deflate 压缩（Options 的零值），所有 ZIP 工具都能解压
+	MethodDeflate = "deflate"
+	// MethodZstd Zstandard 压缩，压缩率和速度都优于 Deflate，但只有 xzip 等支持 zstd 的工具能够解压
+	MethodZstd = "zstd"
+)
+
+// DefaultStoreExts 常见的已压缩格式的扩展名，这类文件再用 Deflate 压缩几乎不能减小体积，反而浪费 CPU
+var DefaultStoreExts = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic",
+	".mp3", ".aac", ".ogg", ".flac", ".mp4", ".mkv", ".mov", ".avi", ".webm",
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar", ".jar",
+	".docx", ".xlsx", ".pptx", ".pdf",
+}
+
+// Rename 解压时条目名开头路径的替换规则，详见 Options.Renames
+// Old 为空时匹配所有条目，即把所有条目放到 New 之下；New 为空时去掉 Old
+type Rename struct {
+	Old string
+	New string
+}
+
+// Options 压缩与解压选项
+type Options struct {
+	// Format 压缩时生成的归档格式，空字符串等同于 FormatZip；解压时按文件内容自动识别，忽略此项
+	Format string
+
+	// Method ZIP 条目的压缩方法，空字符串等同于 MethodDeflate；仅用于 ZIP 格式，解压时按条目记录自动识别
+	Method string
+
+	// Level 压缩级别：1-9 对应 Deflate 级别，LevelDefault 为默认级别，LevelStore 为仅存储
+	Level int
+
+	// StoreExts 压缩 ZIP 时扩展名在其中的文件仅存储、不压缩，如 .jpg（不区分大小写，可省略开头的点）；
+	// 为空时所有文件都按 Method 压缩。通常设为 DefaultStoreExts
+	StoreExts []string
+
+	// Excludes 压缩时的排除规则，详见 isExcluded
+	Excludes []string
+
+	// Includes 压缩时的包含规则，语法与 Excludes 相同；不为空时只添加自身或所在目录命中其中任一规则的条目。
+	// 排除优先：命中 Excludes（或忽略规则文件）的条目即使命中 Includes 也不添加
+	Includes []string
+
+	// IgnoreFile 压缩时使用的忽略规则文件（与 .gitignore 语法相同），规则相对于每个源的根目录匹配；
+	// 为空时使用文件夹源根目录下的 DefaultIgnoreFile，不存在则不忽略
+	IgnoreFile string
+
+	// Dereference 压缩时跟随符号链接，以链接目标的内容作为普通文件或目录写入归档；
+	// 为 false 时保存符号链接本身。链接指向其所在目录或上级目录形成循环时报错
+	Dereference bool
+
+	// MaxDepth 大于 0 时，压缩只深入每个文件夹源的前 MaxDepth 层：源中的直接内容为第 1 层，
+	// 其子文件夹中的内容为第 2 层，依此类推；第 MaxDepth 层的子文件夹只写入目录条目本身，不再深入。0 不限制
+	MaxDepth int
+
+	// Since 不为零值时，压缩只添加修改时间不早于 Since 的文件和符号链接，用于增量备份；
+	// 目录不按修改时间过滤，仍全部写入。跳过的文件数记录在 Result.Unchanged 中
+	Since time.Time
+
+	// MinFileSize、MaxFileSize 大于 0 时，压缩只添加大小不小于 MinFileSize、不大于 MaxFileSize 字节的普通文件；
+	// 目录和符号链接不按大小过滤，仍全部写入。跳过的文件数记录在 Result.Filtered 中
+	MinFileSize int64
+	MaxFileSize int64
+
+	// Reproducible 生成可复现的归档：条目按名称排序，修改时间统一为 ModTime
+	Reproducible bool
+
+	// ModTime 可复现模式下所有条目的修改时间，零值表示 1980-01-01 00:00:00 UTC（ZIP 可表示的最早时间）
+	ModTime time.Time
+
+	// BaseDir 不为空时，压缩的每个源在归档内的条目名为其相对于 BaseDir 的路径（如 docs/a.txt），源必须位于 BaseDir 之内；
+	// 为空时单个文件夹源的条目直接相对于源路径，多个源以各自的 basename 为前缀。Add 忽略此项
+	BaseDir string
+
+	// Prefix 压缩时在所有条目名前加上的目录（如 release），该目录本身也作为目录条目写入；
+	// 排除规则仍匹配不含 Prefix 的相对路径。Add 忽略此项
+	Prefix string
+
+	// Comment 压缩时写入的 ZIP 归档注释，常用于记录构建信息；tar.gz 不支持归档注释。
+	// 追加时不为空则替换归档原有的注释，为空时保留原有注释
+	Comment string
+
+	// Dedup 压缩 ZIP 时按内容去重：内容与之前某个文件相同的文件写为引用条目，不再重复存储内容，
+	// 格式见 dedupExtraID。xzip 解压时重建所有原始文件，其他解压工具会解压为指向原文件的符号链接；仅用于 ZIP 格式
+	Dedup bool
+
+	// SFXStub 不为空时生成自解压文件：先写入此路径的自解压程序（cmd/xzip-sfx 编译出的可执行文件），
+	// 再写入 ZIP 归档。归档的偏移按程序的大小调整，生成的文件仍是有效的 ZIP，可以直接解压；仅用于 ZIP 格式
+	SFXStub string
+
+	// SplitSize 大于 0 时，压缩 ZIP 写成每卷不超过 SplitSize 字节的分卷归档：target 为 archive.zip 时
+	// 依次写出 archive.z01、archive.z02……，最后一卷为 archive.zip，格式见 splitSignature。
+	// 不小于 64 KiB；不能用于 CompressTo 和自解压文件，仅用于 ZIP 格式。解压和 OpenZip 自动识别分卷归档
+	SplitSize int64
+
+	// Jobs 压缩时并行压缩文件内容的协程数；解压 ZIP 时同时写出的文件数（tar.gz 只能顺序解压）。
+	// 小于等于 1 时串行处理。并行解压时 Result.Paths 按写出完成的顺序排列
+	Jobs int
+
+	// Replace 追加时替换归档中同名的条目；为 false 时遇到同名条目报错
+	Replace bool
+
+	// BufferSize 复制文件内容时的缓冲区大小，小于等于 0 时使用 DefaultBufferSize
+	BufferSize int
+
+	// RateLimit 大于 0 时，压缩、追加和解压复制文件内容的速率不超过每秒 RateLimit 字节（压缩按读取的源文件、
+	// 解压按解压出的内容计），并行处理时共用这一限额；用于避免大归档占满共享机器的磁盘 I/O
+	RateLimit int64
+
+	// TempDir 不为空时，压缩、追加写出的临时归档和解压非文件输入时缓存 ZIP 数据的临时文件都创建在此文件夹中。
+	// 为空时临时归档创建在 target 所在文件夹，缓存文件创建在系统临时文件夹（os.TempDir，Unix 上遵循 TMPDIR）。
+	// 临时归档与 target 不在同一文件系统时无法直接重命名，要先复制到 target 所在文件夹，归档越大代价越高；
+	// 解压的 Atomic 临时文件夹需要整体重命名，总是位于 target 旁边，不受此项影响
+	TempDir string
+
+	// Charset 解压 ZIP 时，未设置 UTF-8 标志的条目名所用的编码（如 gbk、shift-jis、big5），
+	// 为空时按 UTF-8 处理。旧版 Windows 压缩工具以本地代码页保存文件名，不设置 UTF-8 标志
+	Charset string
+
+	// Patterns 解压时只处理名称匹配其中任一规则的条目（path.Match 语法），为空时全部解压
+	Patterns []string
+
+	// StripComponents 解压时去掉条目名开头的若干级路径（类似 tar --strip-components），
+	// 路径层级不多于此数的条目不解压；匹配 Patterns 时使用去掉之前的名称
+	StripComponents int
+
+	// Renames 解压时在去掉 StripComponents 级路径之后，将条目名开头的路径 Old 替换为 New（如 src 替换为 app），
+	// 按路径层级匹配，按顺序使用第一个匹配的规则；替换后的路径同样不允许超出目标目录
+	Renames []Rename
+
+	// OnProgress 不为 nil 时，复制条目内容的过程中定期调用，报告当前条目名、已处理和总共的字节数，
+	// 全部完成时以空的条目名和 bytesDone == bytesTotal 最后调用一次。并行压缩时调用也是串行的。
+	// 解压 tar.gz 时无法预先得知解压后的总大小，按已读取的压缩数据和归档文件大小统计
+	OnProgress func(entry string, bytesDone, bytesTotal int64)
+
+	// Context 不为 nil 时，取消后尽快中止压缩、追加或解压并返回 Context.Err()：
+	// 压缩和追加删除未完成的临时文件，不修改 target；解压删除写了一半的文件，已解压完成的文件保留
+	Context context.Context
+
+	// Verbose 不为 nil 时，每处理一个条目向其输出一行条目名和大小
+	Verbose io.Writer
+
+	// Strict 压缩时遇到设备文件、套接字、命名管道等特殊文件报错；为 false 时跳过并记录在 Result.Skipped 中。
+	// 解压时遇到与之前的条目同名的条目报错；为 false 时改名解压并记录在 Result.Renamed 中
+	Strict bool
+
+	// KeepGoing 压缩时某个文件或目录无法访问、无法打开或读取失败不中止，跳过它并记录在 Result.Errors 中
+	// 条目写入归档过程中的读取错误无法撤销，仍会中止压缩
+	KeepGoing bool
+
+	// DryRun 压缩或解压时只统计将要处理的条目，不创建归档，也不写入磁盘；
+	// 每个条目向 Verbose 输出一行，解压时目标位置已存在的文件会标注出来
+	DryRun bool
+
+	// FileMode 不为 0 时，解压出的文件一律使用此权限，忽略归档中记录的权限；不影响目录和符号链接
+	FileMode os.FileMode
+
+	// PreserveOwner 解压时恢复归档中记录的文件所有者（uid/gid），仅在以 root 运行时生效，
+	// 否则静默跳过；Windows 上不生效
+	PreserveOwner bool
+
+	// Force 解压时覆盖已存在的文件；为 false 时遇到已存在的文件报错
+	Force bool
+
+	// SkipExisting 解压时跳过目标位置已存在、大小和修改时间都与条目相同的文件，用于继续中断的解压；
+	// 已存在但不同的文件视为未解压完成而覆盖，设置了 ConfirmOverwrite 时仍先确认
+	SkipExisting bool
+
+	// Atomic 解压时先解压到 target 旁的临时文件夹，全部成功后再用它替换 target（已存在的 target 整个被替换，
+	// 其中原有的文件不保留）；任何错误都删除临时文件夹，target 保持不变。替换依赖 os.Rename，
+	// 临时文件夹与 target 位于同一文件夹中；target 本身是挂载点等跨文件系统的情况无法重命名，返回错误
+	Atomic bool
+
+	// NoSpaceCheck 解压 ZIP 前不检查目标文件系统的可用空间；默认在可用空间小于待解压条目的总大小时报错，
+	// 不写入任何文件。tar.gz 无法预先得知解压后的大小，不检查
+	NoSpaceCheck bool
+
+	// MaxEntries 解压时最多处理的条目数（含目录，只计匹配 Patterns 的条目），超过时报错中止，用于防御解压炸弹；
+	// 0 使用 DefaultMaxEntries，小于 0 不限制
+	MaxEntries int
+
+	// MaxTotalSize 解压出的内容的总字节数上限，超过时报错中止，用于防御解压炸弹。
+	// 按复制过程中实际解压出的字节累计，不依赖条目中记录的大小（恶意构造的归档可以伪造）；
+	// 0 使用 DefaultMaxTotalSize，小于 0 不限制
+	MaxTotalSize int64
+
+	// ConfirmOverwrite 不为 nil 且未设置 Force 时，解压遇到已存在的文件调用它确认，返回 false 则跳过该文件
+	ConfirmOverwrite func(path string) bool
+
+	// 正在写入的归档（含临时文件）和已存在的目标文件，遍历源时跳过，
+	// 目标位于源之内时（如 xzip compress . out.zip）归档不会包含自身
+	outputs []os.FileInfo
+
+	// 分卷压缩时各卷文件名去掉卷号数字后的绝对路径（如 /path/archive.z），以及写入中的各卷临时文件名的
+	// 绝对路径前缀，遍历源时跳过这些文件
+	volumePrefix string
+	volumeTemp   string
+}
+
+// Result 压缩或解压的统计结果
+type Result struct {
+	// Files 处理的文件数（不含目录）
+	Files int
+	// Bytes 文件内容的总字节数（未压缩）
+	Bytes int64
+	// ArchiveBytes 压缩时生成的归档大小，解压时为 0
+	ArchiveBytes int64
+	// Paths 解压时写出的文件路径，压缩时为空
+	Paths []string
+	// Skipped 压缩时跳过的特殊文件（归档内的相对路径）
+	Skipped []string
+	// Errors 设置 KeepGoing 时因出错而跳过的文件的错误
+	Errors []error
+	// Matched 解压时名称匹配 Patterns 的条目数（含目录）
+	Matched int
+	// Unchanged 解压时设置 SkipExisting 时因已存在且未改变而跳过的文件数；
+	// 压缩时设置 Since 时因修改时间早于 Since 而跳过的文件数
+	Unchanged int
+	// Filtered 压缩时设置 MinFileSize 或 MaxFileSize 时因大小不在范围内而跳过的文件数
+	Filtered int
+	// Renamed 解压时因与之前的条目同名而改名的条目（改名后的名称）
+	Renamed []string
+	// Deduplicated 压缩时设置 Dedup 时写为引用条目的文件数，这些文件也计入 Files 和 Bytes
+	Deduplicated int
+	// Volumes 分卷压缩时写出的各卷文件名，最后一个是 target 本身
+	Volumes []string
+}
+
+// 记录压缩时跳过的条目，err 为 nil 表示跳过的是特殊文件，errNotModified 表示早于 Since 修改的文件，
+// errSizeFiltered 表示大小不在范围内的文件
+func (r *Result) skip(name string, err error) {
+	switch {
+	case err == nil:
+		r.Skipped = append(r.Skipped, name)
+	case err == errNotModified:
+		r.Unchanged++
+	case err == errSizeFiltered:
+		r.Filtered++
+	default:
+		r.Errors = append(r.Errors, err)
+	}
+}
+
+// 记录文件 path 为输出文件，遍历源时跳过；文件不存在时忽略
+func (o *Options) addOutput(path string) {
+	if info, err := os.Stat(path); err == nil {
+		o.outputs = append(o.outputs, info)
+	}
+}
+
+// 判断 info 是否为输出文件
+func (o Options) isOutput(info os.FileInfo) bool {
+	for _, output := range o.outputs {
+		if os.SameFile(info, output) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断 path 是否为分卷压缩写出的分卷或其临时文件
+func (o Options) isVolume(path string) bool {
+	if o.volumePrefix == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	if o.volumeTemp != "" && strings.HasPrefix(abs, o.volumeTemp) {
+		return true
+	}
+	if !strings.HasPrefix(abs, o.volumePrefix) {
+		return false
+	}
+	digits := abs[len(o.volumePrefix):]
+	if len(digits) < 2 {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// 可复现模式下使用的修改时间
+func (o Options) reproducibleTime() time.Time {
+	if o.ModTime.IsZero() {
+		return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return o.ModTime
+}
+
+// 输出详细信息，未设置 Verbose 时不输出
+func (o Options) verbosef(format string, a ...interface{}) {
+	if o.Verbose != nil {
+		fmt.Fprintf(o.Verbose, format, a...)
+	}
+}
+
+// 条目在归档内的名称：/ 分隔，并加上 Prefix
+// 归档中不保存绝对路径，万一条目名以盘符或 / 开头也去掉
+func (o Options) entryName(name string) string {
+	name = filepath.ToSlash(strings.TrimPrefix(name, filepath.VolumeName(name)))
+	if o.Prefix != "" {
+		name = path.Join(filepath.ToSlash(o.Prefix), name)
+	}
+	return strings.TrimLeft(name, "/")
+}
+
+// Prefix 及其各级父目录的目录条目名，如 a/b 对应 a/、a/b/
+func (o Options) prefixDirs() []string {
+	if o.Prefix == "" {
+		return nil
+	}
+	var dirs []string
+	parts := strings.Split(path.Clean(filepath.ToSlash(o.Prefix)), "/")
+	for i := range parts {
+		dirs = append(dirs, strings.Join(parts[:i+1], "/")+"/")
+	}
+	return dirs
+}
+
+// 复制文件内容时的缓冲区大小
+func (o Options) bufferSize() int {
+	if o.BufferSize <= 0 {
+		return DefaultBufferSize
+	}
+	return o.BufferSize
+}
+
+// 解压时最多处理的条目数，小于 0 表示不限制
+func (o Options) maxEntries() int {
+	if o.MaxEntries == 0 {
+		return DefaultMaxEntries
+	}
+	return o.MaxEntries
+}
+
+// 解压出的内容的总字节数上限，小于 0 表示不限制
+func (o Options) maxTotalSize() int64 {
+	if o.MaxTotalSize == 0 {
+		return DefaultMaxTotalSize
+	}
+	return o.MaxTotalSize
+}
+
+// 复制缓冲区池，并发的复制各自取用一个缓冲区，用完放回复用
+// 复制时检查 ctx，取消后中止复制；limiter 不为 nil 时按其限速
+type bufferPool struct {
+	pool    sync.Pool
+	ctx     context.Context
+	limiter *rateLimiter
+}
+
+// 按 opts 的缓冲区大小、Context 和 RateLimit 创建缓冲区池
+func newBufferPool(opts Options) *bufferPool {
+	size := opts.bufferSize()
+	p := &bufferPool{ctx: opts.context(), limiter: newRateLimiter(opts.RateLimit)}
+	p.pool.New = func() interface{} {
+		buf := make([]byte, size)
+		return &buf
+	}
+	return p
+}
+
+// 使用池中的缓冲区将 src 复制到 dst，ctx 取消后返回 ctx.Err()
+func (p *bufferPool) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := p.pool.Get().(*[]byte)
+	defer p.pool.Put(buf)
+	var reader io.Reader = &contextReader{ctx: p.ctx, reader: src}
+	if p.limiter != nil {
+		reader = &rateReader{ctx: p.ctx, limiter: p.limiter, reader: reader}
+	}
+	return io.CopyBuffer(dst, reader, *buf)
+}
+
+// 每次读取前检查 ctx 的 Reader，使大文件的复制也能及时中止
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(b)
+}
+
+// 取消压缩或解压的 context，未设置 Context 时永不取消
+func (o Options) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// 将 Level 转换为 compress/flate 的压缩级别
+func (o Options) flateLevel() (int, error) {
+	switch {
+	case o.Level == LevelDefault:
+		return flate.DefaultCompression, nil
+	case o.Level == LevelStore:
+		return flate.NoCompression, nil
+	case o.Level >= 1 && o.Level <= 9:
+		return o.Level, nil
+	default:
+		return 0, fmt.Errorf("无效的压缩级别: %d", o.Level)
+	}
+}
+
+// 判断大小为 size 的文件是否在 MinFileSize 到 MaxFileSize 的范围内
+func (o Options) sizeInRange(size int64) bool {
+	if o.MinFileSize > 0 && size < o.MinFileSize {
+		return false
+	}
+	return o.MaxFileSize <= 0 || size <= o.MaxFileSize
+}
+
+// 判断条目是否因扩展名命中 StoreExts 而仅存储
+func (o Options) storeByExt(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return false
+	}
+	for _, storeExt := range o.StoreExts {
+		if "."+strings.ToLower(strings.TrimPrefix(storeExt, ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// 将 Method 转换为 ZIP 的压缩方法号
+func (o Options) zipMethod() (uint16, error) {
+	switch o.Method {
+	case "", MethodDeflate:
+		return zip.Deflate, nil
+	case MethodZstd:
+		return zipMethodZstd, nil
+	default:
+		return 0, fmt.Errorf("不支持的压缩方法: %s", o.Method)
+	}
+}
+
+// 判断路径是否命中排除规则
+// 规则匹配的是归档内的相对路径而不是绝对路径：不含路径分隔符的规则（如 *.log、node_modules）
+// 匹配任意层级的文件或目录名，含分隔符的规则（如 docs/*.tmp）匹配完整相对路径
+func isExcluded(relPath string, excludes []string) bool {
+	for _, pattern := range excludes {
+		if matchRule(relPath, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断路径是否命中包含规则，规则语法与 isExcluded 相同；命中规则的目录下的所有内容都算命中
+// includes 为空时总是命中
+func isIncluded(relPath string, includes []string) bool {
+	if len(includes) == 0 {
+		return true
+	}
+	for name := relPath; name != "." && name != string(filepath.Separator); name = filepath.Dir(name) {
+		for _, pattern := range includes {
+			if matchRule(name, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 判断路径是否命中一条排除或包含规则
+func matchRule(relPath, pattern string) bool {
+	name := relPath
+	if !strings.ContainsRune(pattern, filepath.Separator) {
+		name = filepath.Base(relPath)
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// 判断条目名是否匹配 patterns 中的任一规则，patterns 为空时总是匹配
+func matchEntry(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(name, "/")
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// 去掉条目名开头的 n 级路径，条目的路径层级不多于 n 时返回 false
+func stripComponents(name string, n int) (string, bool) {
+	if n <= 0 {
+		return name, true
+	}
+	isDir := strings.HasSuffix(name, "/")
+	parts := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	if len(parts) <= n {
+		return "", false
+	}
+	name = strings.Join(parts[n:], "/")
+	if isDir {
+		name += "/"
+	}
+	return name, true
+}
+
+// 按 Renames 替换条目名开头的路径，替换后为空（条目就是被去掉的目录本身）时返回 false
+func (o Options) renameEntry(name string) (string, bool) {
+	isDir := strings.HasSuffix(name, "/")
+	trimmed := strings.TrimSuffix(name, "/")
+	for _, rule := range o.Renames {
+		old := strings.Trim(rule.Old, "/")
+		var rest string
+		switch {
+		case old == "":
+			rest = trimmed
+		case trimmed == old:
+			rest = ""
+		case strings.HasPrefix(trimmed, old+"/"):
+			rest = trimmed[len(old)+1:]
+		default:
+			continue
+		}
+
+		renamed := path.Join(strings.Trim(rule.New, "/"), rest)
+		if renamed == "" || renamed == "." {
+			return "", false
+		}
+		if isDir {
+			renamed += "/"
+		}
+		return renamed, true
+	}
+	return name, true
+}
+
+// 判断 path 是否位于 target 目录之内（按路径字面判断）
+func isWithin(target, path string) bool {
+	rel, err := filepath.Rel(target, filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// 拼接解压路径，并确保结果不会越出目标目录（防止 Zip Slip）
+func safeJoin(target, name string) (string, error) {
+	path := filepath.Join(target, name)
+	if !isWithin(target, path) {
+		return "", fmt.Errorf("非法的条目路径 %s: 超出目标目录 %s", name, target)
+	}
+	return path, nil
+}
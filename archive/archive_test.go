@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// 在 dir 下按 files（相对路径到内容）创建文件，返回 dir
+func writeTestTree(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	for name, body := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// 读出 dir 下所有普通文件的相对路径（/ 分隔）和内容
+func readTestTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// 检查 dir 下的文件与 want 完全相同
+func assertTree(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	got := readTestTree(t, dir)
+	var names []string
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if body, ok := got[name]; !ok {
+			t.Errorf("缺少文件 %s", name)
+		} else if body != want[name] {
+			t.Errorf("文件 %s 的内容不同: %q != %q", name, body, want[name])
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("多出文件 %s", name)
+		}
+	}
+}
+
+// 一组内容各异的测试文件，包含子目录
+func sampleFiles() map[string]string {
+	return map[string]string{
+		"a.txt":         "hello",
+		"sub/b.txt":     "world\n",
+		"sub/deep/c.md": "# title\n",
+		"empty.txt":     "",
+	}
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"errors"
+	"io"
+)
+
+// Authorizer 验证使用授权，通过时返回 nil。xzip 命令使用联网验证并带本地缓存的实现
+type Authorizer func() error
+
+// Client 授权验证通过后的会话：NewClient 只验证一次授权，之后的压缩、解压等操作都复用这次验证，
+// 长期运行的服务处理大量归档时不必每次都联网验证
+//
+// Client 创建后不再修改，各方法的选项按值传入、互不影响，可以在多个协程中同时使用
+type Client struct {
+	authorized bool
+}
+
+// 未经 NewClient 创建的 Client 调用方法时返回的错误
+var errUnauthorized = errors.New("Client 未经授权验证，请使用 NewClient 创建")
+
+// NewClient 调用 authorize 验证一次授权，通过后返回 Client；authorize 为 nil 时不验证
+func NewClient(authorize Authorizer) (*Client, error) {
+	if authorize != nil {
+		if err := authorize(); err != nil {
+			return nil, err
+		}
+	}
+	return &Client{authorized: true}, nil
+}
+
+func (c *Client) check() error {
+	if c == nil || !c.authorized {
+		return errUnauthorized
+	}
+	return nil
+}
+
+// Compress 同包函数 Compress
+func (c *Client) Compress(sources []string, target string, opts Options) (*Result, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return Compress(sources, target, opts)
+}
+
+// CompressTo 同包函数 CompressTo
+func (c *Client) CompressTo(sources []string, w io.Writer, opts Options) (*Result, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return CompressTo(sources, w, opts)
+}
+
+// Extract 同包函数 Extract
+func (c *Client) Extract(source, target string, opts Options) (*Result, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return Extract(source, target, opts)
+}
+
+// ExtractReader 同包函数 ExtractReader
+func (c *Client) ExtractReader(r io.Reader, target string, opts Options) (*Result, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return ExtractReader(r, target, opts)
+}
+
+// Add 同包函数 Add
+func (c *Client) Add(target string, sources []string, opts Options) (*Result, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return Add(target, sources, opts)
+}
+
+// Verify 同包函数 Verify
+func (c *Client) Verify(source string) ([]VerifyResult, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return Verify(source)
+}
+
+// OpenZip 同包函数 OpenZip
+func (c *Client) OpenZip(source string) (*ZipReader, error) {
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return OpenZip(source)
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// 写出只含一个文件 a.txt 的源文件夹，返回其路径
+func writeClientSource(t *testing.T, dir string) string {
+	t.Helper()
+	source := filepath.Join(dir, "src")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+// 检查 dir 中解压出的 a.txt
+func checkClientOutput(t *testing.T, dir string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("%s 中的 a.txt 不正确: %q, %v", dir, data, err)
+	}
+}
+
+func TestNewClientAuthorizesOnce(t *testing.T) {
+	calls := 0
+	client, err := NewClient(func() error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	source := writeClientSource(t, dir)
+	for i := 0; i < 3; i++ {
+		target := filepath.Join(dir, fmt.Sprintf("out%d.zip", i))
+		if _, err := client.Compress([]string{source}, target, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, fmt.Sprintf("x%d", i))
+		if _, err := client.Extract(target, out, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		checkClientOutput(t, out)
+	}
+	if calls != 1 {
+		t.Fatalf("授权应当只验证一次，实际 %d 次", calls)
+	}
+}
+
+func TestNewClientAuthorizeError(t *testing.T) {
+	want := errors.New("denied")
+	client, err := NewClient(func() error { return want })
+	if err != want || client != nil {
+		t.Fatalf("授权失败时应返回其错误，得到 %v, %v", client, err)
+	}
+}
+
+func TestClientRequiresNewClient(t *testing.T) {
+	var client *Client
+	if _, err := client.Extract("a.zip", t.TempDir(), Options{}); err != errUnauthorized {
+		t.Fatalf("nil Client 应当报错，得到 %v", err)
+	}
+	if _, err := (&Client{}).Compress([]string{"."}, "a.zip", Options{}); err != errUnauthorized {
+		t.Fatalf("零值 Client 应当报错，得到 %v", err)
+	}
+}
+
+func TestClientConcurrentUse(t *testing.T) {
+	client, err := NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	source := writeClientSource(t, dir)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := filepath.Join(dir, fmt.Sprintf("out%d.zip", i))
+			if _, err := client.Compress([]string{source}, target, Options{Jobs: 2}); err != nil {
+				errs <- err
+				return
+			}
+			if _, err := client.Extract(target, filepath.Join(dir, fmt.Sprintf("x%d", i)), Options{}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	for i := 0; i < 8; i++ {
+		checkClientOutput(t, filepath.Join(dir, fmt.Sprintf("x%d", i)))
+	}
+}
@@ -0,0 +1,849 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ZIP 归档注释的最大长度，长度以 16 位记录在中央目录结尾
+const maxCommentSize = 0xffff
+
+// 计算每个源在归档内的前缀
+// 设置了 BaseDir 时为源相对于 BaseDir 的路径；单个文件夹源时条目直接相对于源路径；单个文件源（含符号链接）时以其 basename 作为条目名，
+// 否则条目名会是相对于自身的 "."；多个源时以各自的 basename 作为前缀，basename 相同则报错
+func sourcePrefixes(sources []string, opts Options) ([]string, error) {
+	if opts.BaseDir != "" {
+		return relativePrefixes(sources, opts.BaseDir)
+	}
+	if len(sources) == 1 {
+		stat := os.Lstat
+		if opts.Dereference {
+			stat = os.Stat
+		}
+		// 源不存在等错误留给遍历时报告
+		if info, err := stat(sources[0]); err != nil || info.IsDir() {
+			return make([]string, 1), nil
+		}
+	}
+	return basenamePrefixes(sources)
+}
+
+// 以每个源的 basename 作为其前缀，basename 相同则报错
+func basenamePrefixes(sources []string) ([]string, error) {
+	prefixes := make([]string, len(sources))
+	seen := make(map[string]string)
+	for i, source := range sources {
+		base := filepath.Base(filepath.Clean(source))
+		if base == "." || base == ".." {
+			abs, err := filepath.Abs(source)
+			if err != nil {
+				return nil, err
+			}
+			base = filepath.Base(abs)
+		}
+
+		// 根目录没有 basename，其条目直接放在归档根下，不能以 / 或盘符开头
+		if base == string(filepath.Separator) {
+			base = ""
+		}
+
+		if other, ok := seen[base]; ok {
+			return nil, fmt.Errorf("源 %s 与 %s 会生成相同的条目名 %s，请重命名其中之一", other, source, base)
+		}
+		seen[base] = source
+		prefixes[i] = base
+	}
+	return prefixes, nil
+}
+
+// 以每个源相对于 base 的路径作为其前缀，源不在 base 之内或两个源的路径相同时报错
+func relativePrefixes(sources []string, base string) ([]string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make([]string, len(sources))
+	seen := make(map[string]string)
+	for i, source := range sources {
+		absSource, err := filepath.Abs(source)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(absBase, absSource)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("源 %s 不在基准目录 %s 之内", source, base)
+		}
+
+		if other, ok := seen[rel]; ok {
+			return nil, fmt.Errorf("源 %s 与 %s 是同一路径", other, source)
+		}
+		seen[rel] = source
+		prefixes[i] = rel
+	}
+	return prefixes, nil
+}
+
+// 记录压缩时跳过的条目，err 为 nil 表示跳过的是特殊文件，errNotModified 表示早于 Since 修改的文件，
+// errSizeFiltered 表示大小不在 MinFileSize 到 MaxFileSize 之间的文件，否则是设置 KeepGoing 时出错的文件
+type skipFunc func(name string, err error)
+
+// 设置了 Since 时，记录跳过的早于 Since 修改的文件
+var errNotModified = errors.New("文件在 Since 之前修改")
+
+// 设置了 MinFileSize 或 MaxFileSize 时，记录跳过的大小不在范围内的文件
+var errSizeFiltered = errors.New("文件大小不在范围内")
+
+// 遍历一个源，对每个未被排除或忽略的文件、目录或符号链接调用 fn，name 为其在归档内的相对路径
+// 设备文件、套接字、命名管道等特殊文件无法打包：opts.Strict 时报错，否则跳过；
+// 设置 opts.KeepGoing 时无法访问的文件或目录同样跳过。skip 不为 nil 时用它记录跳过的条目
+func walkSource(source, prefix string, opts Options, skip skipFunc, fn func(path, name string, info os.FileInfo) error) error {
+	ignore, err := loadIgnore(source, opts)
+	if err != nil {
+		return err
+	}
+
+	walk := filepath.Walk
+	if opts.Dereference {
+		walk = walkDereference
+	}
+
+	return walk(source, func(path string, info os.FileInfo, err error) error {
+		relPath, _ := filepath.Rel(source, path)
+		name := relPath
+		if prefix != "" {
+			name = filepath.Join(prefix, relPath)
+		}
+
+		if err != nil {
+			if !opts.KeepGoing {
+				return err
+			}
+			if skip != nil {
+				skip(filepath.ToSlash(name), err)
+			}
+			return nil
+		}
+
+		if opts.isOutput(info) || opts.isVolume(path) {
+			return nil
+		}
+
+		excluded := name != "." && isExcluded(name, opts.Excludes)
+		if relPath != "." && ignore.ignored(filepath.ToSlash(relPath), info.IsDir()) {
+			excluded = true
+		}
+		if excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 第 MaxDepth 层的目录本身照常处理，但不再深入
+		var stop error
+		if info.IsDir() && relPath != "." && opts.MaxDepth > 0 && pathDepth(relPath) >= opts.MaxDepth {
+			stop = filepath.SkipDir
+		}
+
+		// 未命中包含规则的目录仍需遍历，其下可能有命中的文件，只是不写入目录条目本身
+		if name != "." && !isIncluded(name, opts.Includes) {
+			return stop
+		}
+
+		if !opts.Since.IsZero() && !info.IsDir() && info.ModTime().Before(opts.Since) {
+			if skip != nil {
+				skip(filepath.ToSlash(name), errNotModified)
+			}
+			return nil
+		}
+
+		if info.Mode().IsRegular() && !opts.sizeInRange(info.Size()) {
+			if skip != nil {
+				skip(filepath.ToSlash(name), errSizeFiltered)
+			}
+			return nil
+		}
+
+		if kind := specialFileKind(info.Mode()); kind != "" {
+			if opts.Strict {
+				return fmt.Errorf("无法压缩%s: %s", kind, path)
+			}
+			if skip != nil {
+				skip(filepath.ToSlash(name), nil)
+			}
+			return nil
+		}
+
+		if err := fn(path, name, info); err != nil {
+			return err
+		}
+		return stop
+	})
+}
+
+// 相对于源的路径所在的层级：源中的直接内容为第 1 层
+func pathDepth(relPath string) int {
+	return strings.Count(filepath.ToSlash(relPath), "/") + 1
+}
+
+// 与 filepath.Walk 相同，但跟随符号链接：以链接目标的信息调用 fn，链接到目录时遍历其内容
+func walkDereference(root string, fn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkFollow(root, info, nil, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// 递归遍历 path，ancestors 为当前路径上的各级目录，用于发现符号链接形成的循环
+func walkFollow(path string, info os.FileInfo, ancestors []os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	for _, ancestor := range ancestors {
+		if os.SameFile(ancestor, info) {
+			return fn(path, info, fmt.Errorf("符号链接形成循环: %s", path))
+		}
+	}
+
+	dir, err := os.Open(path)
+	var names []string
+	if err == nil {
+		names, err = dir.Readdirnames(-1)
+		dir.Close()
+	}
+	sort.Strings(names)
+	if walkErr := fn(path, info, err); err != nil || walkErr != nil {
+		return walkErr
+	}
+
+	ancestors = append(ancestors, info)
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := os.Stat(filename)
+		if err != nil {
+			if err := fn(filename, nil, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		if err := walkFollow(filename, fileInfo, ancestors, fn); err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 特殊文件的类型名称，普通文件、目录和符号链接返回空字符串
+func specialFileKind(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular(), mode.IsDir(), mode&os.ModeSymlink != 0:
+		return ""
+	case mode&os.ModeNamedPipe != 0:
+		return "命名管道"
+	case mode&os.ModeSocket != 0:
+		return "套接字"
+	case mode&os.ModeDevice != 0:
+		return "设备文件"
+	default:
+		return "特殊文件"
+	}
+}
+
+// 统计待压缩文件的总字节数（已排除的文件不计入）
+func sourceSize(sources, prefixes []string, opts Options) (int64, error) {
+	var total int64
+	for i, source := range sources {
+		err := walkSource(source, prefixes[i], opts, nil, func(path, name string, info os.FileInfo) error {
+			if info.Mode().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return total, nil
+}
+
+// 检查压缩参数，返回 flate 压缩级别和各个源的前缀
+func prepareCompress(sources []string, opts Options) (int, []string, error) {
+	if len(sources) == 0 {
+		return 0, nil, fmt.Errorf("没有指定压缩源")
+	}
+
+	if opts.Format != "" && opts.Format != FormatZip && opts.Format != FormatTarGz {
+		return 0, nil, fmt.Errorf("不支持的归档格式: %s", opts.Format)
+	}
+
+	level, err := opts.flateLevel()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := opts.zipMethod(); err != nil {
+		return 0, nil, err
+	}
+	if opts.Method != "" && opts.Method != MethodDeflate && opts.Format == FormatTarGz {
+		return 0, nil, fmt.Errorf("tar.gz 格式不支持压缩方法 %s", opts.Method)
+	}
+
+	if opts.Comment != "" && opts.Format == FormatTarGz {
+		return 0, nil, fmt.Errorf("tar.gz 格式不支持归档注释")
+	}
+	if len(opts.Comment) > maxCommentSize {
+		return 0, nil, fmt.Errorf("归档注释过长: %d 字节，ZIP 最多 %d 字节", len(opts.Comment), maxCommentSize)
+	}
+
+	if opts.MinFileSize < 0 || opts.MaxFileSize < 0 || opts.MaxFileSize > 0 && opts.MinFileSize > opts.MaxFileSize {
+		return 0, nil, fmt.Errorf("无效的文件大小范围: %d-%d 字节", opts.MinFileSize, opts.MaxFileSize)
+	}
+
+	if opts.SFXStub != "" && opts.Format == FormatTarGz {
+		return 0, nil, fmt.Errorf("tar.gz 格式不能生成自解压文件")
+	}
+	if opts.Dedup && opts.Format == FormatTarGz {
+		return 0, nil, fmt.Errorf("tar.gz 格式不支持去重")
+	}
+	if opts.SplitSize != 0 {
+		switch {
+		case opts.Format == FormatTarGz:
+			return 0, nil, fmt.Errorf("tar.gz 格式不支持分卷")
+		case opts.SFXStub != "":
+			return 0, nil, fmt.Errorf("自解压文件不能分卷")
+		case opts.SplitSize < minSplitSize:
+			return 0, nil, fmt.Errorf("分卷大小不能小于 %d 字节", minSplitSize)
+		}
+	}
+
+	if opts.Prefix != "" {
+		prefix := path.Clean(filepath.ToSlash(opts.Prefix))
+		if path.IsAbs(prefix) || filepath.IsAbs(opts.Prefix) || prefix == "." || prefix == ".." || strings.HasPrefix(prefix, "../") {
+			return 0, nil, fmt.Errorf("无效的条目名前缀: %s", opts.Prefix)
+		}
+	}
+
+	prefixes, err := sourcePrefixes(sources, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return level, prefixes, nil
+}
+
+// Compress 将 sources 中的文件或文件夹压缩到 target 归档（格式由 opts.Format 指定），target 所在目录不存在时自动创建
+// 多个源时每个源的条目以其 basename 为前缀；命中 opts.Excludes 的目录连同其下所有内容一起跳过
+// 压缩先写入同目录下的临时文件，成功后再重命名为 target，失败时删除临时文件，不会留下不完整的归档
+// 条目或归档超过 4 GiB 时 archive/zip 在关闭条目和归档时自动写入 ZIP64 扩展信息
+// 设置了 opts.SplitSize 时各卷同样先写入临时文件，全部写完后才重命名为各卷的文件名
+func Compress(sources []string, target string, opts Options) (*Result, error) {
+	level, prefixes, err := prepareCompress(sources, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return dryRunCompress(sources, prefixes, opts)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	// 自解压文件需要可执行权限
+	perm := os.FileMode(0644)
+	if opts.SFXStub != "" {
+		perm = 0755
+	}
+	opts.addOutput(target)
+	if opts.SplitSize > 0 {
+		if abs, err := filepath.Abs(target); err == nil {
+			opts.volumePrefix = strings.TrimSuffix(abs, filepath.Ext(abs)) + ".z"
+			opts.volumeTemp = filepath.Join(filepath.Dir(abs), volumeTempPrefix(target))
+		}
+		if abs, err := filepath.Abs(opts.TempDir); err == nil && opts.TempDir != "" {
+			opts.volumeTemp = filepath.Join(abs, volumeTempPrefix(target))
+		}
+		return compressSplit(sources, prefixes, level, target, opts)
+	}
+	return writeFileAtomic(target, opts.TempDir, perm, func(file *os.File) (*Result, error) {
+		opts.addOutput(file.Name())
+		return compress(sources, prefixes, level, file, opts)
+	})
+}
+
+// 调用 write 将归档写入与 target 同目录的临时文件，成功后设置权限 perm 并重命名为 target，失败时删除临时文件
+// tempDir 不为空时临时文件创建在 tempDir 中，与 target 不在同一文件系统时先复制到 target 所在目录再重命名
+func writeFileAtomic(target, tempDir string, perm os.FileMode, write func(file *os.File) (*Result, error)) (*Result, error) {
+	dir := tempDir
+	if dir == "" {
+		// 临时文件与 target 在同一目录，保证重命名是原子的
+		dir = filepath.Dir(target)
+	}
+	zipFile, err := ioutil.TempFile(dir, "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	tempPath := zipFile.Name()
+
+	result, err := write(zipFile)
+	if err == nil {
+		// TempFile 以 0600 创建
+		err = zipFile.Chmod(perm)
+	}
+	if closeErr := zipFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, target)
+		if err != nil && tempDir != "" {
+			err = copyRename(tempPath, target, perm)
+		}
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	return result, nil
+}
+
+// 将 tempPath 复制到 target 所在目录的临时文件，再重命名为 target 并删除 tempPath；
+// 用于 tempPath 与 target 不在同一文件系统、无法直接重命名的情况
+func copyRename(tempPath, target string, perm os.FileMode) error {
+	src, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Chmod(perm)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(dst.Name(), target)
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	return os.Remove(tempPath)
+}
+
+// CompressTo 与 Compress 相同，但将归档数据写入 w
+// zip.Writer 使用数据描述符记录大小和 CRC，tar.gz 本身就是顺序写入的流，都不需要回写，
+// 因此 w 可以是标准输出、管道等不可寻址的流
+func CompressTo(sources []string, w io.Writer, opts Options) (*Result, error) {
+	level, prefixes, err := prepareCompress(sources, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return dryRunCompress(sources, prefixes, opts)
+	}
+	if opts.SplitSize > 0 {
+		return nil, fmt.Errorf("分卷归档只能写入文件")
+	}
+	// 标准输出重定向到源之内的文件时同样跳过它
+	if file, ok := w.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			opts.outputs = append(opts.outputs, info)
+		}
+	}
+	return compress(sources, prefixes, level, w, opts)
+}
+
+// 预演压缩：只遍历源并输出将要添加的条目
+func dryRunCompress(sources, prefixes []string, opts Options) (*Result, error) {
+	result := &Result{}
+	for _, dir := range opts.prefixDirs() {
+		opts.verbosef("  将添加: %s\n", dir)
+	}
+	err := walkSources(sources, prefixes, opts, result.skip, func(path, name string, info os.FileInfo) error {
+		name = opts.entryName(name)
+		switch {
+		case info.IsDir():
+			opts.verbosef("  将添加: %s/\n", name)
+		case info.Mode()&os.ModeSymlink != 0:
+			result.Files++
+			opts.verbosef("  将添加: %s (符号链接)\n", name)
+		default:
+			result.Files++
+			result.Bytes += info.Size()
+			opts.verbosef("  将添加: %s (%d 字节)\n", name, info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 一次压缩操作的状态
+type compressor struct {
+	archive *zip.Writer
+	level   int
+	opts    Options
+	prog    *progress
+	result  *Result
+	buffers *bufferPool
+
+	// 文件条目的压缩方法及其压缩器，并行压缩时工作协程直接使用 newWriter
+	method    uint16
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+
+	// 保护 result 中的 Skipped 和 Errors，并行压缩时遍历协程和写入协程都会记录
+	mu sync.Mutex
+
+	// 追加模式下归档中已有的目录条目名，遍历到同名目录时不再重复写入
+	existingDirs map[string]bool
+
+	// 设置了 Dedup 时，已写入归档的文件按大小分组；只在写入归档的协程中访问
+	dedup map[int64][]*dedupFile
+}
+
+// 创建压缩器，调用方已检查过 opts.Method
+func newCompressor(w io.Writer, level int, opts Options) *compressor {
+	method, _ := opts.zipMethod()
+	newWriter := func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	}
+	if method == zipMethodZstd {
+		newWriter = newZstdWriter(level)
+	}
+
+	archive := zip.NewWriter(w)
+	archive.RegisterCompressor(method, newWriter)
+	c := &compressor{
+		archive:   archive,
+		level:     level,
+		method:    method,
+		newWriter: newWriter,
+		opts:      opts,
+		result:    &Result{},
+		buffers:   newBufferPool(opts),
+	}
+	if opts.Dedup {
+		c.dedup = make(map[int64][]*dedupFile)
+	}
+	return c
+}
+
+func compress(sources, prefixes []string, level int, w io.Writer, opts Options) (*Result, error) {
+	counter := &countingWriter{writer: w}
+
+	var result *Result
+	var err error
+	if opts.Format == FormatTarGz {
+		result, err = compressTarGz(sources, prefixes, level, counter, opts)
+	} else {
+		result, err = compressZip(sources, prefixes, level, counter, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 归档在返回前已经关闭，计数包含中央目录等尾部数据
+	result.ArchiveBytes = counter.n
+	return result, nil
+}
+
+func compressZip(sources, prefixes []string, level int, w io.Writer, opts Options) (result *Result, err error) {
+	var offset int64
+	if opts.SFXStub != "" {
+		n, err := writeStub(opts.SFXStub, w)
+		if err != nil {
+			return nil, err
+		}
+		offset = n
+	}
+
+	c := newCompressor(w, level, opts)
+	defer closeWith(c.archive, &err)
+	// 归档中记录的偏移从文件开头算起，包含自解压程序，其他解压工具也能正确读取
+	c.archive.SetOffset(offset)
+	if err := c.archive.SetComment(opts.Comment); err != nil {
+		return nil, err
+	}
+	return c.addSources(sources, prefixes)
+}
+
+// 将自解压程序 stub 的内容写入 w，返回写入的字节数
+func writeStub(stub string, w io.Writer) (int64, error) {
+	file, err := os.Open(stub)
+	if err != nil {
+		return 0, fmt.Errorf("无法读取自解压程序: %v", err)
+	}
+	defer file.Close()
+	return io.Copy(w, file)
+}
+
+// 关闭 c，*err 为 nil 时以关闭的错误作为返回的错误，在 defer 中配合命名返回值使用
+// zip.Writer、tar.Writer、gzip.Writer 关闭时才写入中央目录等尾部数据并刷新缓冲区，
+// 忽略关闭的错误会在写入失败（如磁盘已满）时得到损坏的归档却报告成功
+func closeWith(c io.Closer, err *error) {
+	if closeErr := c.Close(); *err == nil {
+		*err = closeErr
+	}
+}
+
+// 统计写入字节数的 Writer
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// 记录跳过的条目
+func (c *compressor) skip(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result.skip(name, err)
+}
+
+// 将所有源写入归档
+func (c *compressor) addSources(sources, prefixes []string) (*Result, error) {
+	if err := c.addPrefixDirs(); err != nil {
+		return nil, err
+	}
+
+	if c.opts.OnProgress != nil {
+		total, err := sourceSize(sources, prefixes, c.opts)
+		if err != nil {
+			return nil, err
+		}
+		c.prog = newProgress(c.opts.OnProgress, total)
+		defer c.prog.finish()
+	}
+
+	// 并行路径以原始数据写入条目，字节上与串行路径不同；
+	// 可复现模式下总是走并行路径，使输出与 Jobs 无关
+	if c.opts.Jobs > 1 || c.opts.Reproducible {
+		if err := c.addParallel(sources, prefixes); err != nil {
+			return nil, err
+		}
+		return c.result, nil
+	}
+
+	err := c.walk(sources, prefixes, func(path, name string, info os.FileInfo) error {
+		header, err := c.header(info, name)
+		if err != nil {
+			return err
+		}
+		file := &dedupFile{path: path, name: header.Name}
+		if original := c.duplicateOf(file, info); original != "" {
+			return c.addReference(header, original, info)
+		}
+		return c.addEntry(path, header, info, file)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.result, nil
+}
+
+// 写入 Prefix 的各级目录条目
+func (c *compressor) addPrefixDirs() error {
+	for _, dir := range c.opts.prefixDirs() {
+		header := &zip.FileHeader{Name: dir, Method: zip.Store}
+		header.SetMode(os.ModeDir | 0755)
+		if c.opts.Reproducible {
+			header.SetModTime(c.opts.reproducibleTime())
+		} else {
+			header.Modified = time.Now()
+		}
+		if _, err := c.archive.CreateHeader(header); err != nil {
+			return err
+		}
+		c.opts.verbosef("  添加: %s\n", dir)
+	}
+	return nil
+}
+
+// 遍历到的一个条目
+type walkedEntry struct {
+	path string
+	name string
+	info os.FileInfo
+}
+
+// 依次遍历所有源，追加模式下跳过归档中已有的目录
+func (c *compressor) walk(sources, prefixes []string, fn func(path, name string, info os.FileInfo) error) error {
+	if len(c.existingDirs) > 0 {
+		next := fn
+		fn = func(path, name string, info os.FileInfo) error {
+			if info.IsDir() && c.existingDirs[filepath.ToSlash(name)+"/"] {
+				return nil
+			}
+			return next(path, name, info)
+		}
+	}
+	return walkSources(sources, prefixes, c.opts, c.skip, fn)
+}
+
+// 依次遍历所有源，设置了 Prefix 时单个源的根目录即为 Prefix 目录，不再单独调用 fn
+// 可复现模式下先收集全部条目，按归档内名称（目录带 / 后缀）排序后再调用 fn，
+// 目录名是其子条目名的前缀，因此总排在子条目之前
+func walkSources(sources, prefixes []string, opts Options, skip skipFunc, fn func(path, name string, info os.FileInfo) error) error {
+	if opts.Prefix != "" {
+		next := fn
+		fn = func(path, name string, info os.FileInfo) error {
+			if name == "." && info.IsDir() {
+				return nil
+			}
+			return next(path, name, info)
+		}
+	}
+
+	if !opts.Reproducible {
+		for i, source := range sources {
+			if err := walkSource(source, prefixes[i], opts, skip, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var entries []walkedEntry
+	for i, source := range sources {
+		err := walkSource(source, prefixes[i], opts, skip, func(path, name string, info os.FileInfo) error {
+			entries = append(entries, walkedEntry{path: path, name: name, info: info})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	sortKey := func(entry walkedEntry) string {
+		key := filepath.ToSlash(entry.name)
+		if entry.info.IsDir() {
+			key += "/"
+		}
+		return key
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortKey(entries[i]) < sortKey(entries[j])
+	})
+
+	for _, entry := range entries {
+		if err := fn(entry.path, entry.name, entry.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 根据文件信息生成条目头
+func (c *compressor) header(info os.FileInfo, name string) (*zip.FileHeader, error) {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// 显式记录 Unix 权限（含可执行位），不依赖 FileInfoHeader 的实现
+	header.SetMode(info.Mode())
+
+	// ZIP 规范要求条目名使用 / 分隔，Windows 上 filepath.Rel 得到的是 \ 分隔的路径
+	header.Name = c.opts.entryName(name)
+
+	// 可复现模式下不记录所有者，归档内容与运行的用户无关
+	if c.opts.Reproducible {
+		header.SetModTime(c.opts.reproducibleTime())
+	} else if uid, gid, ok := fileOwner(info); ok {
+		header.Extra = append(header.Extra, unixOwnerExtra(uid, gid)...)
+	}
+
+	if info.IsDir() {
+		header.Name += "/"
+	} else if info.Mode()&os.ModeSymlink != 0 || c.level == flate.NoCompression || c.opts.storeByExt(header.Name) {
+		header.Method = zip.Store
+	} else {
+		header.Method = c.method
+	}
+	return header, nil
+}
+
+// 写入一个条目：目录只写条目头，符号链接写入链接目标，文件写入其内容
+// 文件在写入条目头之前打开，设置 KeepGoing 时打不开的文件不会在归档中留下空条目
+// 文件成功写入后按 dedup 记录，供之后内容相同的文件引用；不需要去重时 dedup 为 nil
+func (c *compressor) addEntry(path string, header *zip.FileHeader, info os.FileInfo, dedup *dedupFile) error {
+	var file *os.File
+	if info.Mode().IsRegular() {
+		var err error
+		file, err = os.Open(path)
+		if err != nil {
+			if c.opts.KeepGoing {
+				c.skip(header.Name, err)
+				return nil
+			}
+			return err
+		}
+		defer file.Close()
+	}
+
+	writer, err := c.archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// 符号链接不跟随，以链接目标作为条目内容，模式位中保留链接类型
+	if info.Mode()&os.ModeSymlink != 0 {
+		linkTarget, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(writer, filepath.ToSlash(linkTarget))
+		c.result.Files++
+		c.opts.verbosef("  添加: %s -> %s\n", header.Name, linkTarget)
+		return err
+	}
+
+	if file != nil {
+		n, err := c.buffers.copy(writer, &progressReader{reader: file, progress: c.prog, name: header.Name})
+		c.result.Files++
+		c.result.Bytes += n
+		c.opts.verbosef("  添加: %s (%d 字节)\n", header.Name, n)
+		if err != nil {
+			return err
+		}
+		c.addWritten(dedup, info)
+		return nil
+	}
+
+	c.opts.verbosef("  添加: %s\n", header.Name)
+	return nil
+}
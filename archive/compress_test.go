@@ -0,0 +1,531 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// 读出 ZIP 归档中的所有条目名
+func zipNames(t *testing.T, path string) []string {
+	t.Helper()
+	reader, err := OpenZip(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+// dir 中没有残留的临时归档
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp-") {
+			t.Errorf("留下了临时文件 %s", entry.Name())
+		}
+	}
+}
+
+// 遍历到一半出错（符号链接形成循环）时不留下不完整的归档
+func TestCompressFailureLeavesNoTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": "a", "b/big.bin": randomData(1 << 20)})
+	if err := os.MkdirAll(filepath.Join(source, "z"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(source, "z", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		target := filepath.Join(out, "new.zip")
+		if _, err := Compress([]string{source}, target, Options{Dereference: true, Jobs: jobs}); err == nil {
+			t.Fatalf("jobs=%d: 符号链接形成循环时应当报错", jobs)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("jobs=%d: 失败后不应留下归档: %v", jobs, err)
+		}
+
+		// 已存在的归档保持不变
+		existing := filepath.Join(out, "existing.zip")
+		if err := ioutil.WriteFile(existing, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Compress([]string{source}, existing, Options{Dereference: true, Jobs: jobs}); err == nil {
+			t.Fatalf("jobs=%d: 符号链接形成循环时应当报错", jobs)
+		}
+		if data, _ := ioutil.ReadFile(existing); string(data) != "old" {
+			t.Fatalf("jobs=%d: 失败后已存在的归档被改动", jobs)
+		}
+		assertNoTempFiles(t, out)
+	}
+}
+
+func TestWriteFileAtomicRemovesTempOnError(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "out.zip")
+	want := errors.New("write failed")
+	_, err := writeFileAtomic(target, "", 0644, func(file *os.File) (*Result, error) {
+		if _, err := file.Write([]byte("partial")); err != nil {
+			t.Fatal(err)
+		}
+		return nil, want
+	})
+	if err != want {
+		t.Fatalf("应返回 write 的错误，得到 %v", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("失败后不应留下归档: %v", err)
+	}
+	assertNoTempFiles(t, dir)
+}
+
+// 在 dir 下写出 n 个可压缩的文件，每个约 size 字节，返回 dir
+func writeBenchTree(b *testing.B, dir string, n, size int) string {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"alpha ", "beta ", "gamma ", "delta ", "epsilon ", "\n"}
+	for i := 0; i < n; i++ {
+		data := make([]byte, 0, size)
+		for len(data) < size {
+			data = append(data, words[rng.Intn(len(words))]...)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("d%02d", i%16), fmt.Sprintf("f%04d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// 条目名一律以 / 分隔，与运行的平台无关
+func TestCompressEntryNamesUseSlash(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), sampleFiles())
+	cases := []Options{
+		{},
+		{Jobs: 4},
+		{Prefix: filepath.Join("release", "v1")},
+		{BaseDir: dir},
+	}
+	for _, opts := range cases {
+		target := filepath.Join(dir, "out.zip")
+		if _, err := Compress([]string{source}, target, opts); err != nil {
+			t.Fatal(err)
+		}
+		names := zipNames(t, target)
+		found := false
+		for _, name := range names {
+			if strings.Contains(name, "\\") {
+				t.Errorf("%+v: 条目名 %q 包含 \\", opts, name)
+			}
+			if strings.HasSuffix(name, "sub/deep/c.md") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%+v: 缺少 sub/deep/c.md: %v", opts, names)
+		}
+	}
+}
+
+// 源是单个文件时归档中只有一个以其 basename 命名的条目
+func TestCompressSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"report.txt": "data"}), "report.txt")
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		target := filepath.Join(dir, "out."+format)
+		result, err := Compress([]string{source}, target, Options{Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Files != 1 {
+			t.Errorf("%s: Files = %d", format, result.Files)
+		}
+		if format == FormatZip {
+			if names := zipNames(t, target); len(names) != 1 || names[0] != "report.txt" {
+				t.Errorf("条目应当只有 report.txt: %v", names)
+			}
+		}
+		out := filepath.Join(dir, "out-"+format)
+		if _, err := Extract(target, out, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, out, map[string]string{"report.txt": "data"})
+	}
+}
+
+// Includes 与 Excludes 同时使用时排除优先；包含的目录下的所有内容都算命中
+func TestCompressIncludeExclude(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{
+		"main.go":          "main",
+		"main_test.go":     "test",
+		"build.log":        "log",
+		"docs/readme.md":   "readme",
+		"docs/api/spec.md": "spec",
+		"vendor/lib/x.go":  "x",
+	})
+	cases := []struct {
+		includes, excludes []string
+		want               []string
+	}{
+		{[]string{"*.go"}, nil, []string{"main.go", "main_test.go", "vendor/lib/x.go"}},
+		{[]string{"*.go"}, []string{"*_test.go"}, []string{"main.go", "vendor/lib/x.go"}},
+		{[]string{"*.go"}, []string{"vendor"}, []string{"main.go", "main_test.go"}},
+		{[]string{"docs"}, []string{"api"}, []string{"docs/readme.md"}},
+		{[]string{filepath.Join("docs", "api"), "*.log"}, nil, []string{"build.log", "docs/api/spec.md"}},
+	}
+	for i, c := range cases {
+		for _, jobs := range []int{1, 4} {
+			target := filepath.Join(dir, "out.zip")
+			opts := Options{Includes: c.includes, Excludes: c.excludes, Jobs: jobs}
+			if _, err := Compress([]string{source}, target, opts); err != nil {
+				t.Fatal(err)
+			}
+			out := filepath.Join(dir, fmt.Sprintf("out%d-%d", i, jobs))
+			if _, err := Extract(target, out, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for name := range readTestTree(t, out) {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(c.want, ",") {
+				t.Errorf("包含 %v 排除 %v (jobs=%d): 得到 %v，应为 %v", c.includes, c.excludes, jobs, got, c.want)
+			}
+		}
+	}
+}
+
+// 无论源以绝对路径、相对路径还是 . 给出，条目名都是相对路径
+func TestCompressNoAbsoluteNames(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), sampleFiles())
+	other := writeTestTree(t, filepath.Join(dir, "other"), map[string]string{"o.txt": "o"})
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(source); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	cases := []struct {
+		sources []string
+		opts    Options
+	}{
+		{[]string{source}, Options{}},
+		{[]string{filepath.Join(source, "a.txt")}, Options{}},
+		{[]string{source, other}, Options{}},
+		{[]string{source, other}, Options{BaseDir: dir}},
+		{[]string{"."}, Options{}},
+		{[]string{"sub", filepath.Join("..", "other")}, Options{}},
+		{[]string{filepath.Join(source, "sub", "..")}, Options{}},
+	}
+	for _, c := range cases {
+		target := filepath.Join(dir, "out.zip")
+		if _, err := Compress(c.sources, target, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range zipNames(t, target) {
+			if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" ||
+				name == ".." || strings.HasPrefix(name, "../") {
+				t.Errorf("源 %v: 条目名 %q 不是相对路径", c.sources, name)
+			}
+		}
+	}
+}
+
+func TestEntryName(t *testing.T) {
+	cases := []struct {
+		opts Options
+		name string
+		want string
+	}{
+		{Options{}, filepath.Join("a", "b", "c.txt"), "a/b/c.txt"},
+		{Options{Prefix: filepath.Join("release", "v1")}, filepath.Join("a", "c.txt"), "release/v1/a/c.txt"},
+		{Options{}, "/abs/c.txt", "abs/c.txt"},
+	}
+	for _, c := range cases {
+		if got := c.opts.entryName(c.name); got != c.want {
+			t.Errorf("entryName(%q) = %q，应为 %q", c.name, got, c.want)
+		}
+	}
+}
+
+// 超过 4 GiB 的稀疏文件压缩后以 ZIP64 记录大小，能完整读回。压缩 4 GiB 数据耗时较长，
+// 只在设置了环境变量 XZIP_LARGE_TESTS 时运行
+func TestCompressZip64RoundTrip(t *testing.T) {
+	if os.Getenv("XZIP_LARGE_TESTS") == "" || testing.Short() {
+		t.Skip("设置 XZIP_LARGE_TESTS=1 运行大文件测试")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "src")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const size = 4<<30 + 1<<20
+	tail := []byte("end of the sparse file")
+	file, err := os.Create(filepath.Join(source, "big.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt(tail, size-int64(len(tail))); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "big.zip")
+	if _, err := Compress([]string{source}, target, Options{Level: 1}); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := OpenZip(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var big *zip.File
+	for _, file := range reader.File {
+		if file.Name == "big.img" {
+			big = file
+		}
+	}
+	if big == nil || big.UncompressedSize64 != size {
+		t.Fatalf("条目大小不正确: %+v", big)
+	}
+
+	// 逐块读回并检查末尾的内容，不把 4 GiB 写到磁盘上
+	rc, err := big.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	last := make([]byte, len(tail))
+	buf := make([]byte, 1<<20)
+	var n int64
+	for {
+		m, err := rc.Read(buf)
+		if m > 0 {
+			n += int64(m)
+			if m >= len(last) {
+				copy(last, buf[m-len(last):m])
+			} else {
+				last = append(last[m:], buf[:m]...)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n != size || string(last) != string(tail) {
+		t.Fatalf("读回 %d 字节，末尾为 %q", n, last)
+	}
+}
+
+// 串行与并行压缩大量文件的对比
+func BenchmarkCompress(b *testing.B) {
+	source := writeBenchTree(b, filepath.Join(b.TempDir(), "src"), 400, 64<<10)
+	for _, jobs := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			target := filepath.Join(b.TempDir(), "out.zip")
+			for i := 0; i < b.N; i++ {
+				result, err := Compress([]string{source}, target, Options{Jobs: jobs})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(result.Bytes)
+			}
+		})
+	}
+}
+
+// 压缩中途取消时返回 Context 的错误，不留下归档和临时文件
+func TestCompressCancel(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"a.bin": randomData(1 << 20), "b.bin": randomData(1 << 20)})
+	out := filepath.Join(dir, "out")
+	if err := os.MkdirAll(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		opts := Options{Context: ctx, Jobs: jobs, BufferSize: 32 << 10}
+		opts.OnProgress = func(entry string, done, total int64) {
+			if done > 0 {
+				cancel()
+			}
+		}
+		target := filepath.Join(out, "out.zip")
+		_, err := Compress([]string{source}, target, opts)
+		cancel()
+		if err != context.Canceled {
+			t.Fatalf("jobs=%d: 应返回 context.Canceled，得到 %v", jobs, err)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Fatalf("jobs=%d: 取消后不应留下归档: %v", jobs, err)
+		}
+		assertNoTempFiles(t, out)
+	}
+}
+
+// 写入 limit 字节之后出错的 Writer
+type failingWriter struct {
+	limit int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errWriteFailed
+	}
+	w.limit -= len(b)
+	return len(b), nil
+}
+
+// 关闭归档时写入中央目录失败，错误要返回给调用者，不能当作成功
+func TestCompressReportsCloseError(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), sampleFiles())
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		var buf bytes.Buffer
+		if _, err := CompressTo([]string{source}, &buf, Options{Format: format}); err != nil {
+			t.Fatal(err)
+		}
+		// 只差最后几个字节，条目都已写完，失败发生在关闭归档时
+		w := &failingWriter{limit: buf.Len() - 8}
+		if _, err := CompressTo([]string{source}, w, Options{Format: format}); err == nil {
+			t.Errorf("%s: 关闭归档时的写入错误应当返回", format)
+		}
+	}
+}
+
+// 目标位于源之内时（如 xzip compress . out.zip）归档不包含自身、临时文件和分卷
+func TestCompressTargetInsideSource(t *testing.T) {
+	dir := t.TempDir()
+	files := sampleFiles()
+	// 分卷压缩时写出多个分卷
+	files["big.bin"] = randomData(2 * minSplitSize)
+	source := writeTestTree(t, filepath.Join(dir, "src"), files)
+	cases := []struct {
+		target string
+		opts   Options
+	}{
+		{"out.zip", Options{}},
+		{"out.zip", Options{Jobs: 4}},
+		{"out.tar.gz", Options{Format: FormatTarGz}},
+		{filepath.Join("sub", "split.zip"), Options{SplitSize: minSplitSize}},
+	}
+	for _, c := range cases {
+		target := filepath.Join(source, c.target)
+		// 第二次压缩时目标已经存在
+		for i := 0; i < 2; i++ {
+			if _, err := Compress([]string{source}, target, c.opts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		out := filepath.Join(dir, "out")
+		if err := os.RemoveAll(out); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Extract(target, out, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, out, files)
+		assertNoTempFiles(t, filepath.Dir(target))
+
+		// 删除这次的输出，以免成为下一个用例的源文件
+		volumes, err := filepath.Glob(strings.TrimSuffix(target, ".zip") + ".z[0-9][0-9]")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range append(volumes, target) {
+			if err := os.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// 压缩时记录可执行位等 Unix 权限，解压时恢复
+func TestExecutableBitRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上没有可执行位")
+	}
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"run.sh": "#!/bin/sh\necho hi\n", "data.txt": "data"})
+	if err := os.Chmod(filepath.Join(source, "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(source, "data.txt"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []Options{{}, {Jobs: 4}, {Format: FormatTarGz}}
+	for i, opts := range cases {
+		target := filepath.Join(dir, fmt.Sprintf("out%d.zip", i))
+		if opts.Format == FormatTarGz {
+			target = filepath.Join(dir, fmt.Sprintf("out%d.tar.gz", i))
+		}
+		if _, err := Compress([]string{source}, target, opts); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(dir, fmt.Sprintf("out%d", i))
+		// 第二次解压覆盖已存在的文件，权限同样要恢复
+		for _, force := range []bool{false, true} {
+			if _, err := Extract(target, out, Options{Force: force}); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range map[string]os.FileMode{"run.sh": 0755, "data.txt": 0640} {
+				info, err := os.Stat(filepath.Join(out, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm() != want {
+					t.Errorf("%+v force=%v: %s 的权限为 %v，应为 %v", opts, force, name, info.Mode().Perm(), want)
+				}
+			}
+		}
+	}
+}
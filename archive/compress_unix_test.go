@@ -0,0 +1,39 @@
+//go:build !windows
+
+package archive
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// 命名管道不能打开读取（会一直阻塞），压缩时跳过；Strict 时报错
+func TestCompressSkipsFIFO(t *testing.T) {
+	dir := t.TempDir()
+	files := sampleFiles()
+	source := writeTestTree(t, filepath.Join(dir, "src"), files)
+	if err := syscall.Mkfifo(filepath.Join(source, "sub", "pipe"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		target := filepath.Join(dir, "out.zip")
+		result, err := Compress([]string{source}, target, Options{Jobs: jobs})
+		if err != nil {
+			t.Fatalf("jobs=%d: %v", jobs, err)
+		}
+		if len(result.Skipped) != 1 || result.Skipped[0] != "sub/pipe" {
+			t.Errorf("jobs=%d: Skipped = %v", jobs, result.Skipped)
+		}
+		out := filepath.Join(dir, "out")
+		if _, err := Extract(target, out, Options{Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, out, files)
+
+		if _, err := Compress([]string{source}, filepath.Join(dir, "strict.zip"), Options{Jobs: jobs, Strict: true}); err == nil {
+			t.Errorf("jobs=%d: Strict 时遇到命名管道应当报错", jobs)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// 去重压缩时，内容与之前某个文件相同的文件写为引用条目，不再重复存储内容：
+//
+//   - 条目本身是仅存储的符号链接条目，内容为从条目所在目录指向被引用条目的相对路径，
+//     不认识引用条目的解压工具会把它解压为指向原文件的符号链接，仍能访问到相同的内容
+//   - 扩展字段中带有 ID 为 dedupExtraID 的字段，数据为 4 字节小端序的文件权限（Unix 权限位），
+//     之后是被引用条目在归档中的完整名称（UTF-8）
+//
+// xzip 解压时识别该扩展字段，以被引用条目的内容和记录的权限解压出普通文件，重建所有原始文件
+const dedupExtraID = 0x7864
+
+// 生成引用 original 条目的扩展字段，mode 为文件自身的权限
+func dedupExtra(mode os.FileMode, original string) []byte {
+	extra := make([]byte, 8+len(original))
+	binary.LittleEndian.PutUint16(extra[0:], dedupExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(4+len(original)))
+	binary.LittleEndian.PutUint32(extra[4:], uint32(mode.Perm()))
+	copy(extra[8:], original)
+	return extra
+}
+
+// 从扩展字段中解析引用的条目名和文件权限
+func parseDedupExtra(extra []byte) (original string, mode os.FileMode, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return "", 0, false
+		}
+		data := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id != dedupExtraID || len(data) <= 4 {
+			continue
+		}
+		return string(data[4:]), os.FileMode(binary.LittleEndian.Uint32(data)).Perm(), true
+	}
+	return "", 0, false
+}
+
+// 引用条目实际对应的文件
+type dedupRef struct {
+	file *zip.File
+	mode os.FileMode
+}
+
+// 找出归档中的引用条目及其引用的条目；引用的条目不存在或本身也是引用条目时报错
+func dedupRefs(files []*zip.File) (map[*zip.File]dedupRef, error) {
+	var refs map[*zip.File]dedupRef
+	var byName map[string]*zip.File
+	for _, file := range files {
+		original, mode, ok := parseDedupExtra(file.Extra)
+		if !ok {
+			continue
+		}
+		if byName == nil {
+			refs = make(map[*zip.File]dedupRef)
+			byName = make(map[string]*zip.File, len(files))
+			for _, f := range files {
+				byName[f.Name] = f
+			}
+		}
+		target := byName[original]
+		if target == nil || target.Mode().IsDir() {
+			return nil, fmt.Errorf("条目 %s 引用的 %s 不存在", file.Name, original)
+		}
+		if _, _, nested := parseDedupExtra(target.Extra); nested {
+			return nil, fmt.Errorf("条目 %s 引用的 %s 本身也是引用条目", file.Name, original)
+		}
+		refs[file] = dedupRef{file: target, mode: mode}
+	}
+	return refs, nil
+}
+
+// 去重时已写入或将要写入归档的文件
+type dedupFile struct {
+	path string
+	name string
+	// 内容的 SHA-256，遇到大小相同的文件时才计算；hashed 为 true 而 hash 为 nil 表示读取失败
+	hash   []byte
+	hashed bool
+}
+
+// 设置了 Dedup 时，返回内容与 file 相同、已写入归档的条目名，没有则返回空字符串
+// 只有已写入过大小相同的文件时才计算哈希；读取失败时不去重，由写入条目时按常规处理错误
+func (c *compressor) duplicateOf(file *dedupFile, info os.FileInfo) string {
+	if c.dedup == nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return ""
+	}
+	written := c.dedup[info.Size()]
+	if len(written) == 0 {
+		return ""
+	}
+	hash := c.dedupHash(file)
+	if hash == nil {
+		return ""
+	}
+	for _, original := range written {
+		if bytes.Equal(c.dedupHash(original), hash) {
+			return original.name
+		}
+	}
+	return ""
+}
+
+// 计算 file 内容的 SHA-256，每个文件只计算一次，读取失败时返回 nil
+func (c *compressor) dedupHash(file *dedupFile) []byte {
+	if file.hashed {
+		return file.hash
+	}
+	file.hashed = true
+
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := c.buffers.copy(hash, f); err != nil {
+		return nil
+	}
+	file.hash = hash.Sum(nil)
+	return file.hash
+}
+
+// 文件条目成功写入归档后调用，设置了 Dedup 时记录该文件，之后内容相同的文件写为引用它的条目。
+// 写入失败或按 KeepGoing 跳过的文件不记录，否则引用条目会指向归档中不存在的条目
+func (c *compressor) addWritten(file *dedupFile, info os.FileInfo) {
+	if c.dedup == nil || file == nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return
+	}
+	c.dedup[info.Size()] = append(c.dedup[info.Size()], file)
+}
+
+// 写入内容与 original 条目相同的文件的引用条目，格式见 dedupExtraID
+func (c *compressor) addReference(header *zip.FileHeader, original string, info os.FileInfo) error {
+	header.Method = zip.Store
+	header.SetMode(os.ModeSymlink | 0777)
+	header.Extra = append(header.Extra, dedupExtra(info.Mode(), original)...)
+
+	writer, err := c.archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, relativeLink(header.Name, original)); err != nil {
+		return err
+	}
+
+	c.result.Files++
+	c.result.Bytes += info.Size()
+	c.result.Deduplicated++
+	c.prog.add(header.Name, info.Size())
+	c.opts.verbosef("  添加: %s (与 %s 相同)\n", header.Name, original)
+	return nil
+}
+
+// 从条目 name 所在目录指向条目 target 的相对路径
+func relativeLink(name, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(name)), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return filepath.ToSlash(rel)
+}
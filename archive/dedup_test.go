@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 内容相同的文件写为引用条目，大小相同而内容不同的文件照常写入，解压后重建所有原始文件
+func TestCompressDedupRoundTrip(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		dir := t.TempDir()
+		files := sampleFiles()
+		files["copy/a.txt"] = files["a.txt"]
+		files["copy/c.md"] = files["sub/deep/c.md"]
+		files["other.txt"] = "HELLO"
+		files["big1.bin"] = strings.Repeat("dedup\n", 64<<10)
+		files["big2.bin"] = files["big1.bin"]
+		source := writeTestTree(t, filepath.Join(dir, "src"), files)
+		target := filepath.Join(dir, "out.zip")
+
+		result, err := Compress([]string{source}, target, Options{Dedup: true, Jobs: jobs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Deduplicated != 3 {
+			t.Errorf("jobs=%d: 应有 3 个引用条目，实际 %d 个", jobs, result.Deduplicated)
+		}
+
+		out := filepath.Join(dir, "out")
+		if _, err := Extract(target, out, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, out, files)
+	}
+}
+
+// 没有写入过大小相同的文件时不计算哈希
+func TestDedupHashesOnlySameSize(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"a.txt": "aaa", "b.txt": "bbbb", "c.txt": "ccc"})
+	c := newCompressor(ioutil.Discard, 6, Options{Dedup: true})
+
+	var written []*dedupFile
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := &dedupFile{path: path, name: name}
+		if original := c.duplicateOf(file, info); original != "" {
+			t.Fatalf("%s 与 %s 内容不同，不应去重", name, original)
+		}
+		c.addWritten(file, info)
+		written = append(written, file)
+	}
+	if a, b, cc := written[0], written[1], written[2]; !a.hashed || b.hashed || !cc.hashed {
+		t.Fatalf("只有大小相同的 a.txt 和 c.txt 应当计算哈希: %v %v %v", a.hashed, b.hashed, cc.hashed)
+	}
+}
+
+// 原文件没有写入归档（按 KeepGoing 跳过）时，内容相同的文件不能写为引用它的条目
+func TestDedupSkipsUnwrittenOriginal(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTree(t, dir, map[string]string{"a.txt": "same", "b.txt": "same"})
+	c := newCompressor(ioutil.Discard, 6, Options{Dedup: true, KeepGoing: true})
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := &dedupFile{path: path, name: name}
+		if original := c.duplicateOf(file, info); original != "" {
+			t.Fatalf("%s 不应引用没有写入的 %s", name, original)
+		}
+		header, err := c.header(info, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "a.txt" {
+			// 遍历之后、打开之前被删除
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.addEntry(path, header, info, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.result.Errors) != 1 || c.result.Files != 1 {
+		t.Fatalf("a.txt 应被跳过、b.txt 应照常写入: %+v", c.result)
+	}
+	if names := c.dedup[4]; len(names) != 1 || names[0].name != "b.txt" {
+		t.Fatalf("只有写入的 b.txt 应当记录: %v", names)
+	}
+	if err := c.archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
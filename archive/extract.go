@@ -0,0 +1,862 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Extract 将 source 归档解压到 target 文件夹
+// 归档格式按文件开头的魔数识别：gzip 数据按 tar.gz 解压，其余按 ZIP 解压。
+// source 是分卷 ZIP 的最后一卷（如 archive.zip）时，同目录下的 archive.z01 等各卷一并读取
+func Extract(source, target string, opts Options) (*Result, error) {
+	volumes, err := openSplit(source)
+	if err != nil {
+		return nil, err
+	}
+	if volumes != nil {
+		defer volumes.Close()
+		return extractWith(target, opts, func(e *extractor) error {
+			reader, err := newZipReader(volumes, volumes.size, source)
+			if err != nil {
+				return err
+			}
+			return e.extractZip(reader)
+		})
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ExtractReader(file, target, opts)
+}
+
+// ExtractReader 与 Extract 相同，但从 r 读取归档，r 可以是标准输入、网络流等不可寻址的流
+// tar.gz 直接流式解压；ZIP 的中央目录位于文件末尾，需要随机访问，r 是普通文件时直接读取，
+// 否则先写入临时文件，解压完成后删除
+func ExtractReader(r io.Reader, target string, opts Options) (*Result, error) {
+	return extractWith(target, opts, func(e *extractor) error {
+		// r 是普通文件时可以随机访问，并能得知大小
+		name := "标准输入"
+		var file *os.File
+		var size int64
+		if f, ok := r.(*os.File); ok {
+			if f != os.Stdin {
+				name = f.Name()
+			}
+			if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+				file, size = f, info.Size()
+			}
+		}
+
+		buffered := bufio.NewReader(r)
+		magic, err := buffered.Peek(len(gzipMagic))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if bytes.Equal(magic, gzipMagic) {
+			err = e.extractTarGz(buffered, size)
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%s 不完整，可能下载中断，请重新下载", name)
+			}
+			return err
+		}
+		return e.extractZipFrom(file, size, buffered, name)
+	})
+}
+
+// 创建解压到 target 的 extractor，调用 run 解压所有条目后设置目录的权限和修改时间；
+// 设置了 Atomic 时先解压到临时文件夹
+func extractWith(target string, opts Options, run func(e *extractor) error) (*Result, error) {
+	if opts.Atomic && !opts.DryRun {
+		return extractAtomic(target, opts, run)
+	}
+
+	for _, pattern := range opts.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的匹配规则 %s: %v", pattern, err)
+		}
+	}
+
+	names, err := nameDecoder(opts.Charset)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &extractor{
+		target:  target,
+		opts:    opts,
+		result:  &Result{},
+		buffers: newBufferPool(opts),
+		names:   names,
+		seen:    make(map[string]bool),
+		limit:   &sizeLimit{max: opts.maxTotalSize()},
+
+		madeDirs: make(map[string]bool),
+	}
+	if err := run(e); err != nil {
+		return nil, err
+	}
+
+	if err := e.finish(); err != nil {
+		return nil, err
+	}
+	return e.result, nil
+}
+
+// 解压到 target 旁的临时文件夹，成功后替换 target，失败时删除临时文件夹
+func extractAtomic(target string, opts Options, run func(e *extractor) error) (*Result, error) {
+	target = filepath.Clean(target)
+	parent := filepath.Dir(target)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+	// 以 . 开头隐藏临时文件夹，与 target 在同一文件夹中，重命名才不会跨文件系统
+	temp, err := ioutil.TempDir(parent, "."+filepath.Base(target)+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Atomic = false
+	result, err := extractWith(temp, opts, run)
+	if err == nil {
+		// TempDir 以 0700 创建
+		err = os.Chmod(temp, 0755)
+	}
+	if err == nil {
+		err = replaceDir(temp, target)
+	}
+	if err != nil {
+		os.RemoveAll(temp)
+		return nil, err
+	}
+
+	for i, p := range result.Paths {
+		if rel, err := filepath.Rel(temp, p); err == nil {
+			result.Paths[i] = filepath.Join(target, rel)
+		}
+	}
+	return result, nil
+}
+
+// 将文件夹 dir 重命名为 target；target 已存在时先改名为备份，dir 就位后删除备份，重命名失败时恢复备份
+func replaceDir(dir, target string) error {
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return os.Rename(dir, target)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s 已存在且不是文件夹", target)
+	}
+
+	backup := dir + ".old"
+	if err := os.Rename(target, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(dir, target); err != nil {
+		os.Rename(backup, target)
+		return err
+	}
+	os.RemoveAll(backup)
+	return nil
+}
+
+// 解压 ZIP 归档：file 不为 nil 时直接随机读取，否则把 r 中的数据写入临时文件后读取
+func (e *extractor) extractZipFrom(file *os.File, size int64, r io.Reader, name string) error {
+	if file == nil {
+		spool, err := ioutil.TempFile(e.opts.TempDir, "xzip-*.zip")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		if size, err = io.Copy(spool, r); err != nil {
+			return err
+		}
+		file = spool
+	}
+
+	reader, err := newZipReader(file, size, name)
+	if err != nil {
+		return err
+	}
+	return e.extractZip(reader)
+}
+
+// 返回指定编码的文件名解码器，charset 为空时返回 nil（按 UTF-8 处理）
+// 编码名称按 WHATWG 编码标准识别，如 gbk、gb18030、shift-jis、big5、euc-kr
+func nameDecoder(charset string) (*encoding.Decoder, error) {
+	if charset == "" {
+		return nil, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("不支持的文件名编码: %s", charset)
+	}
+	return enc.NewDecoder(), nil
+}
+
+// 待解压的一个条目，与归档格式无关
+type extractEntry struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	size    int64
+	// 归档中记录的所有者，hasOwner 为 false 时没有记录
+	uid, gid int
+	hasOwner bool
+	// 打开条目内容；符号链接的内容为链接目标
+	open func() (io.ReadCloser, error)
+}
+
+// 一次解压操作的状态
+type extractor struct {
+	target string
+	opts   Options
+	// 按条目内容统计进度，为 nil 时不统计（tar.gz 按读取的压缩数据统计进度）
+	prog    *progress
+	result  *Result
+	buffers *bufferPool
+	// 未设置 UTF-8 标志的 ZIP 条目名的解码器，为 nil 时不转换
+	names *encoding.Decoder
+	// 已解压的条目名，用于发现重名的条目
+	seen map[string]bool
+	// 解压出的内容的总大小限制
+	limit *sizeLimit
+
+	// 并行解压 ZIP 时限制同时写出的文件数，为 nil 时串行解压。
+	// 条目名的处理、覆盖确认、目录和符号链接都在遍历条目的协程中按顺序完成，只有文件内容的写出是并行的
+	workers chan struct{}
+	wg      sync.WaitGroup
+	// 保护 result 中的 Files、Bytes、Paths 和 err
+	mu sync.Mutex
+	// 工作协程遇到的第一个错误
+	err error
+
+	// 目录的修改时间会被其中文件的写入覆盖，权限也可能不允许写入其中的文件，
+	// 因此目录先以 0755 创建，全部解压完成后再设置归档中记录的权限和修改时间
+	dirs []extractEntry
+	// 已创建（或已确认存在）的目录，写出文件前不必再逐个调用 MkdirAll；只在遍历条目的协程中访问
+	madeDirs map[string]bool
+}
+
+// 解压 ZIP 归档中的所有条目
+func (e *extractor) extractZip(reader *zip.Reader) error {
+	if !e.opts.DryRun {
+		if err := os.MkdirAll(e.target, 0755); err != nil {
+			return err
+		}
+	}
+
+	// 引用条目的内容来自其引用的条目，大小也按被引用的条目计
+	refs, err := dedupRefs(reader.File)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(reader.File))
+	var total int64
+	for i, file := range reader.File {
+		names[i] = file.Name
+		if e.names != nil && file.Flags&0x800 == 0 {
+			decoded, err := e.names.String(file.Name)
+			if err != nil {
+				return fmt.Errorf("无法以 %s 解码条目名 %q: %v", e.opts.Charset, file.Name, err)
+			}
+			names[i] = decoded
+		}
+		if matchEntry(names[i], e.opts.Patterns) {
+			if ref, ok := refs[file]; ok {
+				total += int64(ref.file.UncompressedSize64)
+			} else {
+				total += int64(file.UncompressedSize64)
+			}
+		}
+	}
+	// 条目中记录的大小已经超过限制时不必开始解压；记录的大小可能是伪造的，解压过程中仍按实际数据检查
+	if err := e.limit.check(total); err != nil {
+		return err
+	}
+	if !e.opts.DryRun && !e.opts.NoSpaceCheck {
+		if err := checkSpace(e.target, total); err != nil {
+			return err
+		}
+	}
+
+	e.prog = newProgress(e.opts.OnProgress, total)
+	defer e.prog.finish()
+
+	// zip.File.Open 可以并发调用，每个文件独立读取，因此 ZIP 可以并行解压；tar.gz 只能顺序读取
+	if e.opts.Jobs > 1 {
+		e.workers = make(chan struct{}, e.opts.Jobs)
+	}
+
+	entries := make([]extractEntry, len(reader.File))
+	for i, file := range reader.File {
+		entry := extractEntry{
+			name:    names[i],
+			mode:    zipEntryMode(file),
+			modTime: file.Modified,
+			size:    int64(file.UncompressedSize64),
+			open:    file.Open,
+		}
+		if ref, ok := refs[file]; ok {
+			entry.mode = ref.mode
+			entry.size = int64(ref.file.UncompressedSize64)
+			entry.open = ref.file.Open
+		}
+		entry.uid, entry.gid, entry.hasOwner = parseUnixOwner(file.Extra)
+		entries[i] = entry
+	}
+
+	// 分两遍解压：先按归档中的目录条目创建所有目录，再写出文件和符号链接，
+	// 最后由 finish 设置目录记录的权限和修改时间。tar.gz 只能顺序读取，按条目顺序一遍完成
+	for _, dirs := range []bool{true, false} {
+		for _, entry := range entries {
+			if entry.mode.IsDir() != dirs {
+				continue
+			}
+			if err := e.extract(entry); err != nil {
+				e.wait()
+				return err
+			}
+		}
+	}
+	return e.wait()
+}
+
+// ZIP 条目头中记录的创建平台：只有 Unix 和 macOS 的工具在外部属性中记录 Unix 权限
+const (
+	zipCreatorUnix  = 3
+	zipCreatorMacOS = 19
+)
+
+// ZIP 条目的模式。Windows 等平台的工具不记录 Unix 权限，archive/zip 按 MS-DOS 属性得出的 0666、0777
+// 并不是真正的权限（目录甚至没有执行位，无法进入），按没有记录权限处理，由 entryMode 使用默认权限
+func zipEntryMode(file *zip.File) os.FileMode {
+	mode := file.Mode()
+	if creator := file.CreatorVersion >> 8; creator != zipCreatorUnix && creator != zipCreatorMacOS {
+		mode &^= os.ModePerm
+	}
+	return mode
+}
+
+// 检查 target 所在文件系统是否有 need 字节的可用空间，无法获取可用空间时不检查
+func checkSpace(target string, need int64) error {
+	available, ok := availableSpace(target)
+	if ok && need > 0 && uint64(need) > available {
+		return fmt.Errorf("目标磁盘空间不足: 需要 %d 字节，可用 %d 字节", need, available)
+	}
+	return nil
+}
+
+// 解压单个条目
+func (e *extractor) extract(entry extractEntry) error {
+	if err := e.opts.context().Err(); err != nil {
+		return err
+	}
+	if !matchEntry(entry.name, e.opts.Patterns) {
+		return nil
+	}
+	e.result.Matched++
+	if limit := e.opts.maxEntries(); limit >= 0 && e.result.Matched > limit {
+		return fmt.Errorf("归档中的条目超过 %d 个，可能是解压炸弹，已中止解压", limit)
+	}
+	entry.mode = e.entryMode(entry.mode)
+
+	name, ok := stripComponents(entry.name, e.opts.StripComponents)
+	if !ok {
+		return nil
+	}
+	if name, ok = e.opts.renameEntry(name); !ok {
+		return nil
+	}
+	entry.name = name
+
+	if !entry.mode.IsDir() {
+		name, err := e.uniqueName(entry.name)
+		if err != nil {
+			return err
+		}
+		entry.name = name
+	}
+
+	path, err := safeJoin(e.target, entry.name)
+	if err != nil {
+		return err
+	}
+
+	if e.opts.SkipExisting && e.unchanged(entry, path) {
+		e.result.Unchanged++
+		e.opts.verbosef("  跳过: %s (已存在且未改变)\n", path)
+		return nil
+	}
+
+	if e.opts.DryRun {
+		return e.preview(entry, path)
+	}
+
+	if entry.mode.IsDir() {
+		if err := e.checkDir(entry.name, path); err != nil {
+			return err
+		}
+		if err := e.mkdirAll(path); err != nil {
+			return err
+		}
+		e.dirs = append(e.dirs, entry)
+		return nil
+	}
+	if err := e.checkDir(entry.name, filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := e.mkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	overwrite := e.opts.Force
+	if _, err := os.Lstat(path); err == nil && !e.opts.Force {
+		switch {
+		case e.opts.ConfirmOverwrite != nil:
+			if !e.opts.ConfirmOverwrite(path) {
+				return nil
+			}
+		case !e.opts.SkipExisting:
+			return fmt.Errorf("目标文件已存在: %s", path)
+		}
+		// 设置 SkipExisting 时走到这里的是已改变的文件，多半是上次中断时写了一半
+		overwrite = true
+	}
+
+	if entry.mode&os.ModeSymlink != 0 {
+		// 符号链接可能替换之前创建的目录，先等待并行写入的文件写完，否则工作协程打开文件时
+		// 经由的已是新的符号链接，可能写到目标目录之外
+		if err := e.wait(); err != nil {
+			return err
+		}
+		if err := extractSymlink(entry, e.target, path, overwrite); err != nil {
+			return err
+		}
+		// 符号链接可能替换了已创建的目录，之后的文件重新创建所在目录
+		if len(e.madeDirs) > 0 {
+			e.madeDirs = make(map[string]bool)
+		}
+		if err := e.restoreOwner(entry, path); err != nil {
+			return err
+		}
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.result.Files++
+		e.result.Paths = append(e.result.Paths, path)
+		e.opts.verbosef("  解压: %s (符号链接)\n", path)
+		return nil
+	}
+
+	if e.workers == nil {
+		return e.writeFile(entry, path, overwrite)
+	}
+
+	// 并行解压：前面的文件出错后不再开始新的文件
+	if err := e.workerErr(); err != nil {
+		return err
+	}
+	e.workers <- struct{}{}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer func() { <-e.workers }()
+		if err := e.writeFile(entry, path, overwrite); err != nil {
+			e.mu.Lock()
+			if e.err == nil {
+				e.err = err
+			}
+			e.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// 检查 target 之下直到 dir 的各级路径都不是符号链接，name 为条目名，用于错误信息
+// safeJoin 只按字面检查路径，之前解压出的符号链接叠加起来（如 a -> . 之后再有 a/b -> ..）
+// 会使之后的条目写到 target 之外，因此不允许经由符号链接写入。已由 mkdirAll 创建的目录不必再检查，
+// 解压出符号链接时会清空 madeDirs
+func (e *extractor) checkDir(name, dir string) error {
+	target := filepath.Clean(e.target)
+	rel, err := filepath.Rel(target, dir)
+	if err != nil || rel == "." {
+		return nil
+	}
+	current := target
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		if e.madeDirs[current] {
+			continue
+		}
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			// 其下的各级目录由 mkdirAll 创建
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("非法的条目路径 %s: %s 是符号链接，不能经由它写入", name, current)
+		}
+	}
+	return nil
+}
+
+// 创建目录 dir 及其上级目录，已创建过的目录直接返回
+func (e *extractor) mkdirAll(dir string) error {
+	if e.madeDirs[dir] {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// 上级目录也已存在，记录到解压目标为止
+	for d := dir; !e.madeDirs[d]; d = filepath.Dir(d) {
+		e.madeDirs[d] = true
+		if d == e.target || d == filepath.Dir(d) {
+			break
+		}
+	}
+	return nil
+}
+
+// 写出文件条目的内容并记录到结果中，并行解压时在工作协程中调用
+func (e *extractor) writeFile(entry extractEntry, path string, overwrite bool) error {
+	n, err := extractFile(entry, path, overwrite, e.prog, e.limit, e.buffers)
+	if err != nil {
+		return err
+	}
+	if err := e.restoreOwner(entry, path); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.result.Files++
+	e.result.Bytes += n
+	e.result.Paths = append(e.result.Paths, path)
+	e.opts.verbosef("  解压: %s (%d 字节)\n", path, n)
+	return nil
+}
+
+// 并行解压的工作协程遇到的第一个错误
+func (e *extractor) workerErr() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// 等待所有工作协程结束，返回其中第一个错误；串行解压时直接返回 nil
+func (e *extractor) wait() error {
+	e.wg.Wait()
+	return e.workerErr()
+}
+
+// 解压时使用的模式：条目没有记录权限位时（如某些 Windows 工具生成的归档）文件按 0644、目录按 0755，
+// 设置了 FileMode 时文件使用 FileMode
+func (e *extractor) entryMode(mode os.FileMode) os.FileMode {
+	if mode.Perm() == 0 {
+		switch {
+		case mode.IsDir():
+			mode |= 0755
+		case mode.IsRegular():
+			mode |= 0644
+		}
+	}
+	if e.opts.FileMode != 0 && mode.IsRegular() {
+		mode = mode&^os.ModePerm | e.opts.FileMode.Perm()
+	}
+	return mode
+}
+
+// ZIP 允许多个条目同名，依次解压会互相覆盖而丢失数据
+// 重名的条目在设置 Strict 时报错，否则依次改名为 name.1、name.2
+func (e *extractor) uniqueName(name string) (string, error) {
+	key := path.Clean(name)
+	if !e.seen[key] {
+		e.seen[key] = true
+		return name, nil
+	}
+	if e.opts.Strict {
+		return "", fmt.Errorf("归档中存在重名的条目: %s", name)
+	}
+	for i := 1; ; i++ {
+		unique := fmt.Sprintf("%s.%d", name, i)
+		if key := path.Clean(unique); !e.seen[key] {
+			e.seen[key] = true
+			e.result.Renamed = append(e.result.Renamed, unique)
+			return unique, nil
+		}
+	}
+}
+
+// 判断 path 处是否已有与条目大小和修改时间都相同的普通文件
+// ZIP 的修改时间精确到秒（DOS 时间为 2 秒），按秒比较
+func (e *extractor) unchanged(entry extractEntry, path string) bool {
+	if !entry.mode.IsRegular() {
+		return false
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return info.Size() == entry.size && info.ModTime().Truncate(time.Second).Equal(entry.modTime.Truncate(time.Second))
+}
+
+// 预演解压单个条目：只输出将要写入的文件，已存在的文件标注出来
+func (e *extractor) preview(entry extractEntry, path string) error {
+	if entry.mode.IsDir() {
+		return nil
+	}
+
+	var note string
+	if _, err := os.Lstat(path); err == nil {
+		note = "，已存在"
+	}
+
+	if entry.mode&os.ModeSymlink != 0 {
+		linkTarget, err := readLinkTarget(entry, e.target, path)
+		if err != nil {
+			return err
+		}
+		e.opts.verbosef("  将解压: %s -> %s (符号链接%s)\n", path, linkTarget, note)
+	} else {
+		e.result.Bytes += entry.size
+		e.opts.verbosef("  将解压: %s (%d 字节%s)\n", path, entry.size, note)
+	}
+	e.result.Files++
+	e.result.Paths = append(e.result.Paths, path)
+	return nil
+}
+
+// 设置了 PreserveOwner 时恢复条目的所有者，没有权限或归档中没有记录时跳过
+func (e *extractor) restoreOwner(entry extractEntry, path string) error {
+	if !e.opts.PreserveOwner || !entry.hasOwner || !canChown() {
+		return nil
+	}
+	return chown(path, entry.uid, entry.gid)
+}
+
+// 设置目录的所有者、权限和修改时间
+func (e *extractor) finish() error {
+	// 子目录排在父目录之前处理，父目录的权限不会妨碍设置子目录
+	sort.Slice(e.dirs, func(i, j int) bool {
+		return e.dirs[i].name > e.dirs[j].name
+	})
+	for _, dir := range e.dirs {
+		path, _ := safeJoin(e.target, dir.name)
+		// 目录之后可能被同名的符号链接条目替换，不经由符号链接修改权限和时间
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			continue
+		}
+		if err := e.restoreOwner(dir, path); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, dir.mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(path, dir.modTime, dir.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解压单个文件条目到 path，返回写入的字节数，文件句柄在返回前关闭
+// overwrite 为 false 时若 path 已存在则失败，不会覆盖
+func extractFile(entry extractEntry, path string, overwrite bool, prog *progress, limit *sizeLimit, buffers *bufferPool) (int64, error) {
+	fileReader, err := entry.open()
+	if err != nil {
+		return 0, err
+	}
+	defer fileReader.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		// 覆盖时替换已存在的符号链接本身，不写入其指向的文件
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	targetFile, err := os.OpenFile(path, flags, entry.mode.Perm())
+	if err != nil {
+		return 0, err
+	}
+
+	// *os.File 实现了 io.ReaderFrom，直接传入时 CopyBuffer 不会使用给定的缓冲区
+	reader := &limitReader{reader: fileReader, limit: limit}
+	n, err := buffers.copy(struct{ io.Writer }{targetFile}, &progressReader{reader: reader, progress: prog, name: entry.name})
+	if err == nil {
+		// OpenFile 的权限受 umask 影响，覆盖已存在的文件时也不生效，显式设置才能保留可执行位等权限
+		err = targetFile.Chmod(entry.mode.Perm())
+	}
+	closeErr := targetFile.Close()
+	if err != nil {
+		// 写了一半的文件内容不完整，删除以免被误用（被中止、超过大小限制或归档损坏时）
+		os.Remove(path)
+		return 0, err
+	}
+	if closeErr != nil {
+		return 0, closeErr
+	}
+
+	return n, os.Chtimes(path, entry.modTime, entry.modTime)
+}
+
+// 解压出的内容的总大小限制，用于防御解压炸弹：几 KB 的归档可以解压出数 TB 的数据耗尽磁盘
+// 并行解压时多个工作协程同时累计
+type sizeLimit struct {
+	mu sync.Mutex
+	// 允许的总字节数，小于 0 表示不限制
+	max  int64
+	used int64
+}
+
+// 检查再解压 n 字节是否会超过限制
+func (l *sizeLimit) check(n int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.exceeded(n)
+}
+
+// 累计解压出的 n 字节，超过限制时返回错误且不累计
+func (l *sizeLimit) add(n int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.exceeded(n); err != nil {
+		return err
+	}
+	l.used += n
+	return nil
+}
+
+func (l *sizeLimit) exceeded(n int64) error {
+	if l.max >= 0 && l.used+n > l.max {
+		return fmt.Errorf("解压出的内容超过 %d 字节，可能是解压炸弹，已中止解压", l.max)
+	}
+	return nil
+}
+
+// 读取时累计解压出的字节数，超过限制时返回错误
+// 按实际读出的数据统计，条目中记录的大小可能是伪造的
+type limitReader struct {
+	reader io.Reader
+	limit  *sizeLimit
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if limitErr := r.limit.add(int64(n)); limitErr != nil {
+		return 0, limitErr
+	}
+	return n, err
+}
+
+// 符号链接目标的最大长度
+const maxLinkTargetSize = 4096
+
+// 读取符号链接条目的链接目标，链接目标不允许是绝对路径，也不允许指向 target 之外
+// 按字面检查之外，还由 checkLinkTarget 对照磁盘上已有的路径检查
+func readLinkTarget(entry extractEntry, target, path string) (string, error) {
+	fileReader, err := entry.open()
+	if err != nil {
+		return "", err
+	}
+	defer fileReader.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(fileReader, maxLinkTargetSize))
+	if err != nil {
+		return "", err
+	}
+
+	linkTarget := filepath.FromSlash(string(data))
+	if filepath.IsAbs(linkTarget) || !isWithin(target, filepath.Join(filepath.Dir(path), linkTarget)) {
+		return "", fmt.Errorf("非法的符号链接 %s -> %s: 超出目标目录 %s", entry.name, linkTarget, target)
+	}
+	if err := checkLinkTarget(filepath.Dir(path), linkTarget); err != nil {
+		return "", fmt.Errorf("非法的符号链接 %s -> %s: %v", entry.name, linkTarget, err)
+	}
+	return linkTarget, nil
+}
+
+// 从 dir 出发逐级检查链接目标 linkTarget 经过的路径。按字面检查时 .. 只是去掉上一级，
+// 而磁盘上经过符号链接后的 .. 是链接指向处的上级，之前解压出的符号链接叠加起来
+// （如 y -> . 之后再有 x -> y/..）会指向 target 之外，因此经过已存在的符号链接之后不允许再用 .. 返回上级；
+// 经过尚不存在的路径之后也不允许，之后的条目可能在那里解压出符号链接。
+// 只向下经过符号链接（如 lib.so -> lib.so.1）不受影响，各个符号链接在解压时都已检查过
+func checkLinkTarget(dir, linkTarget string) error {
+	current := dir
+	// 不为空时 current 不是磁盘上的实际位置，记录原因
+	var unknown string
+	for _, part := range strings.Split(linkTarget, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if unknown != "" {
+				return fmt.Errorf("%s，不能经由它返回上级", unknown)
+			}
+			current = filepath.Dir(current)
+			continue
+		}
+		current = filepath.Join(current, part)
+		if unknown != "" {
+			continue
+		}
+		info, err := os.Lstat(current)
+		switch {
+		case os.IsNotExist(err):
+			unknown = current + " 尚不存在"
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			unknown = current + " 是符号链接"
+		}
+	}
+	return nil
+}
+
+// 解压符号链接条目
+func extractSymlink(entry extractEntry, target, path string, overwrite bool) error {
+	linkTarget, err := readLinkTarget(entry, target, path)
+	if err != nil {
+		return err
+	}
+
+	if overwrite {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Symlink(linkTarget, path)
+}
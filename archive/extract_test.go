@@ -0,0 +1,636 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试用的归档条目：mode 为 0 时按普通文件写入
+type testEntry struct {
+	name string
+	body string
+	mode os.FileMode
+}
+
+// 在 dir 中写出由 entries 组成的 ZIP 归档，返回其路径
+func writeTestZip(t *testing.T, dir string, entries []testEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, "test.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		header.SetMode(mode)
+		writer, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 在 dir 中写出由 entries 组成的 tar.gz 归档，返回其路径
+func writeTestTarGz(t *testing.T, dir string, entries []testEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, "test.tar.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.body))}
+		switch {
+		case entry.mode&os.ModeSymlink != 0:
+			header = &tar.Header{Name: entry.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: entry.body}
+		case entry.mode.IsDir():
+			header = &tar.Header{Name: entry.name, Mode: 0755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractRejectsParentTraversal(t *testing.T) {
+	for _, name := range []string{"../escape.txt", "a/../../escape.txt", "a/b/../../../escape.txt"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			source := writeTestZip(t, dir, []testEntry{{name: name, body: "x"}})
+			target := filepath.Join(dir, "out")
+
+			if _, err := Extract(source, target, Options{}); err == nil {
+				t.Fatal("包含 ../ 的条目应当报错")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+				t.Fatalf("文件被写到了目标目录之外: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractTarGzRejectsParentTraversal(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTarGz(t, dir, []testEntry{{name: "ok.txt", body: "ok"}, {name: "../escape.txt", body: "x"}})
+	if _, err := Extract(source, filepath.Join(dir, "out"), Options{}); err == nil {
+		t.Fatal("包含 ../ 的条目应当报错")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("文件被写到了目标目录之外: %v", err)
+	}
+}
+
+// 替换后的条目名同样不能越出目标目录
+func TestExtractRenameCannotEscape(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestZip(t, dir, []testEntry{{name: "src/escape.txt", body: "x"}})
+	opts := Options{Renames: []Rename{{Old: "src", New: ".."}}}
+	if _, err := Extract(source, filepath.Join(dir, "out"), opts); err == nil {
+		t.Fatal("替换为 .. 的条目应当报错")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("文件被写到了目标目录之外: %v", err)
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	target := filepath.Join("base", "out")
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{"a.txt", true},
+		{"sub/../a.txt", true},
+		{"/abs.txt", true},
+		{"..", false},
+		{"../escape.txt", false},
+		{"sub/../../escape.txt", false},
+		{"../out2/a.txt", false},
+	}
+	for _, c := range cases {
+		path, err := safeJoin(target, c.name)
+		if (err == nil) != c.ok {
+			t.Errorf("safeJoin(%q) = %q, %v", c.name, path, err)
+		}
+		if err == nil && !isWithin(target, path) {
+			t.Errorf("safeJoin(%q) = %q 不在目标目录之内", c.name, path)
+		}
+	}
+}
+
+func TestExtractRejectsSymlinkOutsideTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	for _, link := range []string{"..", "../other", "/etc"} {
+		t.Run(link, func(t *testing.T) {
+			dir := t.TempDir()
+			source := writeTestZip(t, dir, []testEntry{{name: "link", body: link, mode: os.ModeSymlink | 0777}})
+			if _, err := Extract(source, filepath.Join(dir, "out"), Options{}); err == nil {
+				t.Fatalf("指向目标目录之外的符号链接 %s 应当报错", link)
+			}
+		})
+	}
+}
+
+// 链接目标按字面在目标目录之内，但经过之前解压出的符号链接后指向目标目录之外：
+// y -> . 之后 x -> y/.. 实际指向目标目录的上级；x -> a/.. 之后 a -> . 同理
+func TestExtractRejectsChainedSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	cases := map[string][]testEntry{
+		"existing": {
+			{name: "y", body: ".", mode: os.ModeSymlink | 0777},
+			{name: "x", body: "y/..", mode: os.ModeSymlink | 0777},
+		},
+		"later": {
+			{name: "x", body: "a/..", mode: os.ModeSymlink | 0777},
+			{name: "a", body: ".", mode: os.ModeSymlink | 0777},
+		},
+	}
+	for name, entries := range cases {
+		for _, jobs := range []int{1, 4} {
+			dir := t.TempDir()
+			source := writeTestZip(t, dir, entries)
+			target := filepath.Join(dir, "out")
+
+			_, err := Extract(source, target, Options{Jobs: jobs})
+			if err == nil || !strings.Contains(err.Error(), "符号链接") {
+				t.Fatalf("%s jobs=%d: 经由符号链接指向目标目录之外应当报错，得到 %v", name, jobs, err)
+			}
+			if resolved, err := filepath.EvalSymlinks(filepath.Join(target, "x")); err == nil && !isWithin(target, resolved) {
+				t.Fatalf("%s jobs=%d: x 指向了目标目录之外的 %s", name, jobs, resolved)
+			}
+		}
+	}
+}
+
+// 指向另一个符号链接的链接（如共享库的版本链接）不经过 .. 返回上级，可以解压
+func TestExtractSymlinkToSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	source := writeTestZip(t, dir, []testEntry{
+		{name: "lib/libx.so.1.2", body: "library"},
+		{name: "lib/libx.so.1", body: "libx.so.1.2", mode: os.ModeSymlink | 0777},
+		{name: "lib/libx.so", body: "libx.so.1", mode: os.ModeSymlink | 0777},
+		{name: "current", body: "lib/libx.so", mode: os.ModeSymlink | 0777},
+	})
+	target := filepath.Join(dir, "out")
+	if _, err := Extract(source, target, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(target, "current")); err != nil || string(data) != "library" {
+		t.Fatalf("经由符号链接读取的内容不正确: %q, %v", data, err)
+	}
+}
+
+// a -> . 与 a/b -> .. 各自按字面都在目标目录之内，叠加后 a/b/escape.txt 实际位于目标目录的上级
+func TestExtractRejectsWritingThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	for _, jobs := range []int{1, 4} {
+		dir := t.TempDir()
+		source := writeTestZip(t, dir, []testEntry{
+			{name: "a", body: ".", mode: os.ModeSymlink | 0777},
+			{name: "a/b", body: "..", mode: os.ModeSymlink | 0777},
+			{name: "a/b/escape.txt", body: "escaped"},
+		})
+		target := filepath.Join(dir, "out")
+
+		_, err := Extract(source, target, Options{Jobs: jobs})
+		if err == nil || !strings.Contains(err.Error(), "符号链接") {
+			t.Fatalf("jobs=%d: 经由符号链接写入应当报错，得到 %v", jobs, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+			t.Fatalf("jobs=%d: 文件被写到了目标目录之外: %v", jobs, err)
+		}
+	}
+}
+
+func TestExtractTarGzRejectsWritingThroughSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	source := writeTestTarGz(t, dir, []testEntry{
+		{name: "a", body: ".", mode: os.ModeSymlink | 0777},
+		{name: "a/b", body: "..", mode: os.ModeSymlink | 0777},
+		{name: "a/b/escape.txt", body: "escaped"},
+	})
+	if _, err := Extract(source, filepath.Join(dir, "out"), Options{}); err == nil {
+		t.Fatal("经由符号链接写入应当报错")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("文件被写到了目标目录之外: %v", err)
+	}
+}
+
+func TestExtractRejectsFileUnderSymlinkedDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	source := writeTestZip(t, dir, []testEntry{
+		{name: "sub/", mode: os.ModeDir | 0755},
+		{name: "link", body: "sub", mode: os.ModeSymlink | 0777},
+		{name: "link/file.txt", body: "x"},
+	})
+	if _, err := Extract(source, filepath.Join(dir, "out"), Options{}); err == nil {
+		t.Fatal("经由符号链接目录写入应当报错")
+	}
+}
+
+// 覆盖已存在的符号链接时替换链接本身，不写入其指向的文件
+func TestExtractForceReplacesSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	outside := filepath.Join(dir, "outside.txt")
+	if err := ioutil.WriteFile(outside, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "out")
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(target, "file.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	source := writeTestZip(t, dir, []testEntry{{name: "file.txt", body: "new"}})
+	if _, err := Extract(source, target, Options{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(outside); string(data) != "original" {
+		t.Fatalf("符号链接指向的文件被改写: %q", data)
+	}
+	info, err := os.Lstat(filepath.Join(target, "file.txt"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("符号链接应被替换为普通文件: %v", err)
+	}
+}
+
+// 并行解压时，符号链接 x 替换已创建的目录 x 之前，其中的 x/evil 必须已经写完，
+// 否则工作协程打开文件时经由 x -> y/.. 与 y -> . 写到目标目录的上级
+func TestExtractParallelSymlinkReplacesDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上创建符号链接需要特殊权限")
+	}
+	dir := t.TempDir()
+	source := writeTestZip(t, dir, []testEntry{
+		{name: "x/evil", body: "escaped"},
+		{name: "y", body: ".", mode: os.ModeSymlink | 0777},
+		{name: "x", body: "y/..", mode: os.ModeSymlink | 0777},
+	})
+	for i := 0; i < 50; i++ {
+		target := filepath.Join(dir, fmt.Sprintf("out%d", i))
+		// x 中已有文件，替换为符号链接时报错与否都可以，只要没有写到目标目录之外
+		Extract(source, target, Options{Force: true, Jobs: 4})
+		if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+			t.Fatalf("第 %d 次解压: 文件被写到了目标目录之外: %v", i, err)
+		}
+	}
+}
+
+// 显式的空目录条目被创建，并在解压完成后设置为归档中记录的权限
+func TestExtractEmptyDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不区分这些权限位")
+	}
+	for _, jobs := range []int{1, 4} {
+		dir := t.TempDir()
+		source := writeTestZip(t, dir, []testEntry{
+			{name: "private/file.txt", body: "x"},
+			{name: "private/", mode: os.ModeDir | 0700},
+			{name: "empty/", mode: os.ModeDir | 0700},
+			{name: "empty/nested/", mode: os.ModeDir | 0750},
+		})
+		target := filepath.Join(dir, "out")
+		if _, err := Extract(source, target, Options{Jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]os.FileMode{"private": 0700, "empty": 0700, "empty/nested": 0750} {
+			info, err := os.Stat(filepath.Join(target, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatalf("jobs=%d: %v", jobs, err)
+			}
+			if !info.IsDir() || info.Mode().Perm() != want {
+				t.Errorf("jobs=%d: %s 的模式为 %v，应为 %v", jobs, name, info.Mode(), want)
+			}
+		}
+	}
+}
+
+// 不同缓冲区大小下解压大文件的吞吐量；仅存储的条目不经过解压缩，主要衡量复制本身
+func BenchmarkExtractBufferSize(b *testing.B) {
+	dir := b.TempDir()
+	source := filepath.Join(dir, "src")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		b.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "big.bin"), []byte(randomData(256<<20)), 0644); err != nil {
+		b.Fatal(err)
+	}
+	zipPath := filepath.Join(dir, "big.zip")
+	if _, err := Compress([]string{source}, zipPath, Options{Level: LevelStore}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{32 << 10, DefaultBufferSize, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("buffer=%dKiB", size>>10), func(b *testing.B) {
+			target := filepath.Join(b.TempDir(), "out")
+			for i := 0; i < b.N; i++ {
+				result, err := Extract(zipPath, target, Options{BufferSize: size, Force: true})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(result.Bytes)
+			}
+		})
+	}
+}
+
+// 重名的条目依次改名解压，不互相覆盖；Strict 时报错
+func TestExtractDuplicateNames(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := writeTestZip(t, dir, []testEntry{
+		{name: "a.txt", body: "first"},
+		{name: "a.txt", body: "second"},
+		{name: "sub/b.txt", body: "b"},
+		{name: "a.txt", body: "third"},
+	})
+	tarPath := writeTestTarGz(t, dir, []testEntry{
+		{name: "a.txt", body: "first"},
+		{name: "a.txt", body: "second"},
+		{name: "sub/b.txt", body: "b"},
+		{name: "a.txt", body: "third"},
+	})
+
+	for _, source := range []string{zipPath, tarPath} {
+		target := filepath.Join(dir, "out-"+filepath.Base(source))
+		result, err := Extract(source, target, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, target, map[string]string{"a.txt": "first", "a.txt.1": "second", "a.txt.2": "third", "sub/b.txt": "b"})
+		if strings.Join(result.Renamed, ",") != "a.txt.1,a.txt.2" {
+			t.Errorf("%s: Renamed = %v", source, result.Renamed)
+		}
+
+		_, err = Extract(source, filepath.Join(dir, "strict-"+filepath.Base(source)), Options{Strict: true})
+		if err == nil || !strings.Contains(err.Error(), "重名") {
+			t.Errorf("%s: Strict 时重名的条目应当报错，得到 %v", source, err)
+		}
+	}
+}
+
+// 写出条目不带权限位的 ZIP 归档（外部属性为 0），creator 为条目头中的创建平台
+func writeNoModeZip(t *testing.T, dir string, creator uint16) string {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("nomode-%d.zip", creator))
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, name := range []string{"dir/", "dir/file.txt", "top.txt"} {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, CreatorVersion: creator << 8}
+		writer, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			if _, err := writer.Write([]byte(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 条目没有记录权限位（或由 Windows 工具生成，不记录 Unix 权限）时文件按 0644、目录按 0755 解压，
+// FileMode 覆盖文件的权限
+func TestExtractDefaultModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不区分这些权限位")
+	}
+	dir := t.TempDir()
+	const creatorUnix, creatorNTFS = 3, 11
+	cases := []struct {
+		creator  uint16
+		opts     Options
+		fileMode os.FileMode
+		dirMode  os.FileMode
+	}{
+		{creatorUnix, Options{}, 0644, 0755},
+		{creatorUnix, Options{FileMode: 0600}, 0600, 0755},
+		{creatorNTFS, Options{}, 0644, 0755},
+		{creatorNTFS, Options{FileMode: 0640}, 0640, 0755},
+	}
+	for i, c := range cases {
+		target := filepath.Join(dir, fmt.Sprintf("out%d", i))
+		if _, err := Extract(writeNoModeZip(t, dir, c.creator), target, c.opts); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]os.FileMode{"top.txt": c.fileMode, "dir/file.txt": c.fileMode, "dir": c.dirMode} {
+			info, err := os.Stat(filepath.Join(target, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("creator=%d %+v: %s 的权限为 %v，应为 %v", c.creator, c.opts, name, info.Mode().Perm(), want)
+			}
+		}
+	}
+}
+
+// 串行与并行解压大量小文件的对比
+func BenchmarkExtractJobs(b *testing.B) {
+	dir := b.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		files[fmt.Sprintf("d%02d/f%04d.txt", i%20, i)] = randomData(4 << 10)
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	zipPath := filepath.Join(dir, "small.zip")
+	if _, err := Compress([]string{filepath.Join(dir, "src")}, zipPath, Options{}); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, jobs := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			target := filepath.Join(b.TempDir(), "out")
+			for i := 0; i < b.N; i++ {
+				result, err := Extract(zipPath, target, Options{Jobs: jobs, Force: true})
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(result.Bytes)
+			}
+		})
+	}
+}
+
+// 解压中途取消时返回 Context 的错误，写了一半的文件被删除，已完成的文件保留
+func TestExtractCancel(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"a.bin": randomData(1 << 20), "b.bin": randomData(1 << 20), "c.bin": randomData(1 << 20)}
+	source := filepath.Join(dir, "in.zip")
+	if _, err := Compress([]string{writeTestTree(t, filepath.Join(dir, "src"), files)}, source, Options{Reproducible: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobs := range []int{1, 4} {
+		ctx, cancel := context.WithCancel(context.Background())
+		opts := Options{Context: ctx, Jobs: jobs, BufferSize: 32 << 10}
+		opts.OnProgress = func(entry string, done, total int64) {
+			if done > 1<<20+1<<19 {
+				cancel()
+			}
+		}
+		target := filepath.Join(dir, fmt.Sprintf("out%d", jobs))
+		_, err := Extract(source, target, opts)
+		cancel()
+		if err != context.Canceled {
+			t.Fatalf("jobs=%d: 应返回 context.Canceled，得到 %v", jobs, err)
+		}
+		got := readTestTree(t, target)
+		if len(got) == len(files) {
+			t.Errorf("jobs=%d: 取消后不应解压出全部文件", jobs)
+		}
+		for name, body := range got {
+			if body != files[name] {
+				t.Errorf("jobs=%d: 留下了不完整的文件 %s", jobs, name)
+			}
+		}
+	}
+}
+
+// 目录条目的权限和修改时间在其中的文件写出之后设置，不被覆盖；只读目录中的文件也能写出
+func TestExtractDirModesAndTimes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows 上不区分这些权限位")
+	}
+	dir := t.TempDir()
+	source := filepath.Join(dir, "dirs.zip")
+	file, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)
+	w := zip.NewWriter(file)
+	entries := []struct {
+		name string
+		mode os.FileMode
+	}{
+		// 文件排在所在目录的条目之前
+		{"readonly/inner/file.txt", 0644},
+		{"readonly/", os.ModeDir | 0555},
+		{"readonly/inner/", os.ModeDir | 0700},
+		{"shared/", os.ModeDir | 0775},
+		{"shared/file.txt", 0644},
+	}
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: modified}
+		header.SetMode(entry.mode)
+		writer, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !entry.mode.IsDir() {
+			if _, err := writer.Write([]byte(entry.name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		target := filepath.Join(dir, fmt.Sprintf("out%d", jobs))
+		if _, err := Extract(source, target, Options{Jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, target, map[string]string{"readonly/inner/file.txt": "readonly/inner/file.txt", "shared/file.txt": "shared/file.txt"})
+		for _, entry := range entries {
+			if !entry.mode.IsDir() {
+				continue
+			}
+			info, err := os.Stat(filepath.Join(target, filepath.FromSlash(entry.name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != entry.mode.Perm() {
+				t.Errorf("jobs=%d: %s 的权限为 %v，应为 %v", jobs, entry.name, info.Mode().Perm(), entry.mode.Perm())
+			}
+			if !info.ModTime().Equal(modified) {
+				t.Errorf("jobs=%d: %s 的修改时间为 %v，应为 %v", jobs, entry.name, info.ModTime(), modified)
+			}
+		}
+		// 只读目录不能被测试框架删除
+		if err := os.Chmod(filepath.Join(target, "readonly"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+//go:build !windows
+
+package archive
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// 每个条目的文件在写完后立即关闭：条目数远多于可打开的文件数时解压仍能完成
+func TestExtractManyEntriesWithLowFileLimit(t *testing.T) {
+	dir := t.TempDir()
+	var entries []testEntry
+	files := make(map[string]string)
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("d%d/f%d.txt", i%10, i)
+		entries = append(entries, testEntry{name: name, body: name})
+		files[name] = name
+	}
+	source := writeTestZip(t, dir, entries)
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	low := limit
+	low.Cur = 64
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+		t.Skipf("无法降低打开文件数限制: %v", err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+
+	for _, jobs := range []int{1, 4} {
+		out := filepath.Join(dir, fmt.Sprintf("out%d", jobs))
+		if _, err := Extract(source, out, Options{Jobs: jobs}); err != nil {
+			t.Fatalf("jobs=%d: %v", jobs, err)
+		}
+		assertTree(t, out, files)
+	}
+}
@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultIgnoreFile 未指定 Options.IgnoreFile 时，在文件夹源根目录下查找的忽略规则文件
+const DefaultIgnoreFile = ".xzipignore"
+
+// 忽略规则文件中的一条规则，语法与 .gitignore 相同
+type ignoreRule struct {
+	// 按 / 分割的匹配规则，** 匹配任意多级目录
+	segments []string
+	// 以 ! 开头，重新包含之前的规则忽略的路径
+	negate bool
+	// 以 / 结尾，只匹配目录
+	dirOnly bool
+	// 开头或中间含有 /，相对于源根目录匹配；否则匹配任意层级的文件或目录名
+	anchored bool
+}
+
+// 一个忽略规则文件中的全部规则，后面的规则优先
+type ignoreList []ignoreRule
+
+// 读取源 source 适用的忽略规则：设置了 opts.IgnoreFile 时读取该文件，
+// 否则读取文件夹源根目录下的 DefaultIgnoreFile，不存在时没有规则
+func loadIgnore(source string, opts Options) (ignoreList, error) {
+	file := opts.IgnoreFile
+	if file == "" {
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			return nil, nil
+		}
+		file = filepath.Join(source, DefaultIgnoreFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	return parseIgnoreFile(file)
+}
+
+// 解析忽略规则文件：空行和 # 开头的行被忽略，! 取反，/ 结尾只匹配目录，\ 转义开头的 # 和 !
+func parseIgnoreFile(file string) (ignoreList, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules ignoreList
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.segments = strings.Split(line, "/")
+		for _, segment := range rule.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("%s 第 %d 行: 无效的忽略规则 %s", file, lineNo, scanner.Text())
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// 判断源内的相对路径（/ 分隔）是否被忽略，以最后一条匹配的规则为准
+func (l ignoreList) ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range l {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := strings.Split(relPath, "/")
+		if !rule.anchored {
+			name = name[len(name)-1:]
+		}
+		if matchSegments(rule.segments, name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// 逐级匹配路径，** 匹配零或多级目录，位于末尾时匹配其下的全部内容（至少一级）
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return len(name) > 0
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZIP 文件开头可能出现的魔数：本地文件头，以及空归档的中央目录结束记录
+var zipMagics = [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}
+
+// bzip2 在 ZIP 中的压缩方法号，只用于解压，xzip 不生成这样的条目
+const zipMethodBzip2 = 12
+
+// ZipReader OpenZip 打开的 ZIP 归档，用完后调用 Close 关闭
+type ZipReader struct {
+	*zip.Reader
+	closer io.Closer
+	// Split 是否为分卷归档
+	Split bool
+}
+
+// Close 关闭归档文件（分卷归档为所有分卷）
+func (r *ZipReader) Close() error {
+	return r.closer.Close()
+}
+
+// OpenZip 打开 ZIP 归档，并注册 zstd 和 bzip2 解压器；source 为分卷归档的最后一卷时自动读取同目录下的各卷
+// 打不开时区分空文件、不是 ZIP 文件和 ZIP 文件损坏（多为下载不完整），返回说明原因的错误
+func OpenZip(source string) (*ZipReader, error) {
+	volumes, err := openSplit(source)
+	if err != nil {
+		return nil, err
+	}
+	if volumes != nil {
+		reader, err := newZipReader(volumes, volumes.size, source)
+		if err != nil {
+			volumes.Close()
+			return nil, err
+		}
+		return &ZipReader{Reader: reader, closer: volumes, Split: true}, nil
+	}
+
+	reader, err := zip.OpenReader(source)
+	if err != nil {
+		// 文件本身无法读取时原样返回
+		file, openErr := os.Open(source)
+		if openErr != nil {
+			return nil, err
+		}
+		defer file.Close()
+		if info, statErr := file.Stat(); statErr != nil || info.IsDir() {
+			return nil, err
+		}
+		return nil, describeZipError(file, source, err)
+	}
+	registerDecompressors(&reader.Reader)
+	return &ZipReader{Reader: &reader.Reader, closer: reader}, nil
+}
+
+// 从 r 读取大小为 size 的 ZIP 归档，并注册 zstd 和 bzip2 解压器；name 用于错误信息
+func newZipReader(r io.ReaderAt, size int64, name string) (*zip.Reader, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, describeZipError(r, name, err)
+	}
+	registerDecompressors(reader)
+	return reader, nil
+}
+
+// 为 reader 注册标准库未内置的解压器
+func registerDecompressors(reader *zip.Reader) {
+	reader.RegisterDecompressor(zipMethodZstd, zstd.ZipDecompressor())
+	reader.RegisterDecompressor(zipMethodBzip2, func(r io.Reader) io.ReadCloser {
+		return ioutil.NopCloser(bzip2.NewReader(r))
+	})
+}
+
+// 根据开头的魔数说明 ZIP 归档打不开的原因
+func describeZipError(r io.ReaderAt, source string, err error) error {
+	magic := make([]byte, 4)
+	n, _ := r.ReadAt(magic, 0)
+	if n == 0 {
+		return fmt.Errorf("%s 是空文件，可能下载不完整，请重新下载", source)
+	}
+	for _, zipMagic := range zipMagics {
+		if bytes.Equal(magic[:n], zipMagic) {
+			return fmt.Errorf("%s 已损坏或不完整（%v），可能下载中断，请重新下载", source, err)
+		}
+	}
+	return fmt.Errorf("%s 不是 ZIP 文件（%v）", source, err)
+}
@@ -0,0 +1,200 @@
+package archive
+
+import (
+	"archive/zip"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 空文件、不是 ZIP 的文件和截断的 ZIP 给出不同的错误说明
+func TestOpenZipDescribesErrors(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"a.txt": randomData(64 << 10)})
+	valid := filepath.Join(dir, "valid.zip")
+	if _, err := Compress([]string{source}, valid, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"empty.zip", "", "是空文件"},
+		{"random.zip", "not a zip" + randomData(1000), "不是 ZIP 文件"},
+		{"truncated.zip", string(data[:len(data)/2]), "已损坏或不完整"},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		if err := ioutil.WriteFile(path, []byte(c.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := OpenZip(path)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("OpenZip(%s) 的错误应当包含 %q，得到 %v", c.name, c.want, err)
+		}
+		_, err = Extract(path, filepath.Join(dir, "out"), Options{})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Extract(%s) 的错误应当包含 %q，得到 %v", c.name, c.want, err)
+		}
+	}
+}
+
+// WinZip AES 加密条目的扩展字段：AE-2，AES-256，实际压缩方法为 Deflate
+var aesExtra = []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 3, 8, 0}
+
+// 测试用的加密条目：name 按原样写入，utf8 为 true 时设置 UTF-8 标志，aes 为 true 时按 WinZip AES 加密，否则按 ZipCrypto
+type encryptedEntry struct {
+	name string
+	utf8 bool
+	aes  bool
+}
+
+// 写出由加密条目组成的 ZIP 归档，条目内容是随意的字节（测试只读取条目名）
+func writeEncryptedZip(t *testing.T, dir string, entries []encryptedEntry) string {
+	t.Helper()
+	path := filepath.Join(dir, "encrypted.zip")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Flags: 0x1, UncompressedSize64: 100}
+		if entry.utf8 {
+			header.Flags |= 0x800
+		}
+		// AES 加密数据：16 字节盐、2 字节密码校验值、密文和 10 字节认证码；ZipCrypto 为 12 字节加密头和密文
+		data := strings.Repeat("\x5a", 64)
+		if entry.aes {
+			header.Method = 99
+			header.Extra = aesExtra
+		} else {
+			header.Method = zip.Deflate
+			header.CRC32 = 0x12345678
+		}
+		header.CompressedSize64 = uint64(len(data))
+		writer, err := w.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 加密条目的条目名不加密，AES 扩展字段不影响 UTF-8 标志的含义；
+// 未设置 UTF-8 标志的旧编码条目名按 Charset 解码，与是否加密无关
+func TestEncryptedEntryNames(t *testing.T) {
+	dir := t.TempDir()
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String("旧文档/说明.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := writeEncryptedZip(t, dir, []encryptedEntry{
+		{name: "文档/报告.txt", utf8: true, aes: true},
+		{name: "データ.csv", utf8: true},
+		{name: gbk, aes: true},
+	})
+
+	reader, err := OpenZip(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	reader.Close()
+	if names[0] != "文档/报告.txt" || names[1] != "データ.csv" {
+		t.Errorf("加密条目的条目名不正确: %q", names)
+	}
+
+	// 预演解压只解码条目名，不需要解密内容
+	target := filepath.Join(dir, "out")
+	result, err := Extract(source, target, Options{DryRun: true, Charset: "gbk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, path := range result.Paths {
+		rel, _ := filepath.Rel(target, path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	if strings.Join(got, ",") != "文档/报告.txt,データ.csv,旧文档/说明.txt" {
+		t.Errorf("解码后的条目名不正确: %q", got)
+	}
+}
+
+// "hello bzip2\n" 重复 20 次，以 bzip2 压缩后的数据（由 Python 的 bz2 模块生成，Go 标准库只能解压 bzip2）
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xcb, 0xac, 0x81, 0xb1, 0x00, 0x00,
+	0x3b, 0xd9, 0x80, 0x00, 0x10, 0x40, 0x00, 0x10, 0x00, 0x12, 0x64, 0xc0, 0x10, 0x20, 0x00, 0x50,
+	0x80, 0x69, 0xa6, 0x80, 0xa5, 0x50, 0x68, 0xd3, 0xd4, 0xe4, 0x9b, 0x27, 0xc4, 0xec, 0x9e, 0x93,
+	0x44, 0xc2, 0x6c, 0x98, 0x26, 0x13, 0x09, 0xf8, 0xbb, 0x92, 0x29, 0xc2, 0x84, 0x86, 0x5d, 0x64,
+	0x0d, 0x88,
+}
+
+// 压缩方法为 bzip2（12）的条目可以解压和校验
+func TestExtractBzip2Entry(t *testing.T) {
+	dir := t.TempDir()
+	body := strings.Repeat("hello bzip2\n", 20)
+	source := filepath.Join(dir, "bzip2.zip")
+	file, err := os.Create(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(file)
+	header := &zip.FileHeader{
+		Name:               "docs/readme.txt",
+		Method:             zipMethodBzip2,
+		CRC32:              crc32.ChecksumIEEE([]byte(body)),
+		CompressedSize64:   uint64(len(bzip2Data)),
+		UncompressedSize64: uint64(len(body)),
+	}
+	header.SetMode(0644)
+	writer, err := w.CreateRaw(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write(bzip2Data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "out")
+	if _, err := Extract(source, target, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, target, map[string]string{"docs/readme.txt": body})
+
+	results, err := Verify(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Errorf("bzip2 条目应当校验通过: %+v", results)
+	}
+}
@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"encoding/binary"
+)
+
+// Info-ZIP 新版 Unix 扩展字段（"ux"），记录条目的 uid 和 gid
+const unixOwnerExtraID = 0x7875
+
+// 生成 Info-ZIP Unix 扩展字段，uid 和 gid 各占 4 字节
+func unixOwnerExtra(uid, gid int) []byte {
+	extra := make([]byte, 15)
+	binary.LittleEndian.PutUint16(extra[0:], unixOwnerExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 11)
+	extra[4] = 1 // 版本
+	extra[5] = 4
+	binary.LittleEndian.PutUint32(extra[6:], uint32(uid))
+	extra[10] = 4
+	binary.LittleEndian.PutUint32(extra[11:], uint32(gid))
+	return extra
+}
+
+// 从扩展字段中解析 Info-ZIP Unix 扩展字段记录的 uid 和 gid
+func parseUnixOwner(extra []byte) (uid, gid int, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return 0, 0, false
+		}
+		data := extra[4 : 4+size]
+		extra = extra[4+size:]
+
+		if id != unixOwnerExtraID || len(data) < 1 || data[0] != 1 {
+			continue
+		}
+		data = data[1:]
+
+		uidValue, data, ok := readOwnerID(data)
+		if !ok {
+			return 0, 0, false
+		}
+		gidValue, _, ok := readOwnerID(data)
+		if !ok {
+			return 0, 0, false
+		}
+		return int(uidValue), int(gidValue), true
+	}
+	return 0, 0, false
+}
+
+// 读取一个带长度前缀的小端序 id，返回 id 和剩余数据
+func readOwnerID(data []byte) (uint64, []byte, bool) {
+	if len(data) < 1 {
+		return 0, nil, false
+	}
+	size := int(data[0])
+	if size > 8 || len(data) < 1+size {
+		return 0, nil, false
+	}
+
+	var id uint64
+	for i := size - 1; i >= 0; i-- {
+		id = id<<8 | uint64(data[1+i])
+	}
+	return id, data[1+size:], true
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package archive
+
+import (
+	"os"
+	"syscall"
+)
+
+// 获取文件的 uid 和 gid
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// 是否有权限修改文件所有者
+func canChown() bool {
+	return os.Geteuid() == 0
+}
+
+// 修改文件所有者，符号链接修改其自身而不是链接目标
+func chown(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
@@ -0,0 +1,17 @@
+package archive
+
+import "os"
+
+// Windows 没有 uid 和 gid，不记录所有者
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// Windows 上不恢复所有者
+func canChown() bool {
+	return false
+}
+
+func chown(path string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// 并行压缩：工作协程将文件内容分别压缩到内存缓冲区，写入协程再按遍历顺序
+// 依次以原始数据写入归档，因此条目顺序与串行压缩一致，归档内容可复现。
+// 超过 parallelMaxBufferSize 的文件不预先压缩，轮到它时由写入协程直接流式压缩，
+// 以免大文件占用过多内存。
+const parallelMaxBufferSize = 32 << 20
+
+var errStopped = errors.New("压缩已中止")
+
+// 按遍历顺序排队等待写入的条目
+type pendingEntry struct {
+	path   string
+	header *zip.FileHeader
+	info   os.FileInfo
+	// 设置了 Dedup 时由写入协程与已写入的文件比较内容
+	dedup *dedupFile
+
+	// 以下字段在 done 关闭后有效
+	done       chan struct{}
+	compressed bool // 为 true 时 data 中是已压缩的数据
+	data       bytes.Buffer
+	err        error
+}
+
+// 并行压缩所有源
+func (c *compressor) addParallel(sources, prefixes []string) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	jobs := c.opts.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	entries := make(chan *pendingEntry, jobs)
+	workers := make(chan struct{}, jobs)
+	walkErr := make(chan error, 1)
+
+	go func() {
+		defer close(entries)
+		// 设置了 Dedup 时已遍历到的文件大小，只在遍历协程中访问
+		sizes := make(map[int64]bool)
+		err := c.walk(sources, prefixes, func(path, name string, info os.FileInfo) error {
+			header, err := c.header(info, name)
+			if err != nil {
+				return err
+			}
+
+			entry := &pendingEntry{path: path, header: header, info: info, done: make(chan struct{})}
+			// 与之前的文件大小相同时可能是重复的文件，不预先压缩，由写入协程在之前的文件写入后比较内容，
+			// 再决定写为引用条目还是直接写入
+			duplicate := false
+			if c.opts.Dedup && info.Mode().IsRegular() && info.Size() > 0 {
+				entry.dedup = &dedupFile{path: path, name: header.Name}
+				duplicate = sizes[info.Size()]
+				sizes[info.Size()] = true
+			}
+			if !duplicate && info.Mode().IsRegular() && info.Size() <= parallelMaxBufferSize {
+				select {
+				case workers <- struct{}{}:
+				case <-stop:
+					return errStopped
+				}
+				go func() {
+					defer func() { <-workers }()
+					c.compressEntry(entry)
+				}()
+			} else {
+				close(entry.done)
+			}
+
+			select {
+			case entries <- entry:
+				return nil
+			case <-stop:
+				return errStopped
+			}
+		})
+		if err != nil {
+			walkErr <- err
+		}
+	}()
+
+	for entry := range entries {
+		<-entry.done
+		if entry.err != nil {
+			// 预先压缩的数据还没有写入归档，跳过不会留下不完整的条目
+			if c.opts.KeepGoing {
+				c.skip(entry.header.Name, entry.err)
+				continue
+			}
+			return entry.err
+		}
+
+		var original string
+		if entry.dedup != nil && !entry.compressed {
+			original = c.duplicateOf(entry.dedup, entry.info)
+		}
+
+		var err error
+		if original != "" {
+			err = c.addReference(entry.header, original, entry.info)
+		} else if entry.compressed {
+			err = c.addRawEntry(entry)
+		} else {
+			err = c.addEntry(entry.path, entry.header, entry.info, entry.dedup)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-walkErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// 将文件内容压缩到 entry.data，并填好条目头中的 CRC32 和大小
+func (c *compressor) compressEntry(entry *pendingEntry) {
+	defer close(entry.done)
+
+	file, err := os.Open(entry.path)
+	if err != nil {
+		entry.err = err
+		return
+	}
+	defer file.Close()
+
+	hash := crc32.NewIEEE()
+	reader := io.TeeReader(&progressReader{reader: file, progress: c.prog, name: entry.header.Name}, hash)
+
+	var n int64
+	if entry.header.Method != zip.Store {
+		var w io.WriteCloser
+		w, err = c.newWriter(&entry.data)
+		if err == nil {
+			n, err = c.buffers.copy(w, reader)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+	} else {
+		n, err = c.buffers.copy(&entry.data, reader)
+	}
+	if err != nil {
+		entry.err = err
+		return
+	}
+
+	entry.header.CRC32 = hash.Sum32()
+	entry.header.UncompressedSize64 = uint64(n)
+	entry.header.CompressedSize64 = uint64(entry.data.Len())
+	entry.compressed = true
+}
+
+// 以原始数据写入已压缩的条目
+func (c *compressor) addRawEntry(entry *pendingEntry) error {
+	prepareRawHeader(entry.header)
+
+	writer, err := c.archive.CreateRaw(entry.header)
+	if err != nil {
+		return err
+	}
+	if _, err := entry.data.WriteTo(writer); err != nil {
+		return err
+	}
+
+	n := int64(entry.header.UncompressedSize64)
+	c.result.Files++
+	c.result.Bytes += n
+	c.opts.verbosef("  添加: %s (%d 字节)\n", entry.header.Name, n)
+	c.addWritten(entry.dedup, entry.info)
+	return nil
+}
+
+// CreateRaw 不会像 CreateHeader 那样补全条目头，这里按 CreateHeader 的规则补全：
+// 非 ASCII 文件名的 UTF-8 标志、版本号，以及 Info-ZIP 扩展时间戳
+func prepareRawHeader(header *zip.FileHeader) {
+	for _, r := range header.Name {
+		if r >= utf8.RuneSelf {
+			if utf8.ValidString(header.Name) {
+				header.Flags |= 0x800
+			}
+			break
+		}
+	}
+
+	header.CreatorVersion = header.CreatorVersion&0xff00 | 20
+	header.ReaderVersion = 20
+
+	if !header.Modified.IsZero() {
+		var extra [9]byte
+		binary.LittleEndian.PutUint16(extra[0:], 0x5455) // 扩展时间戳
+		binary.LittleEndian.PutUint16(extra[2:], 5)
+		extra[4] = 1 // 仅包含修改时间
+		binary.LittleEndian.PutUint32(extra[5:], uint32(header.Modified.Unix()))
+		header.Extra = append(header.Extra, extra[:]...)
+	}
+}
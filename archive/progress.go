@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"io"
+	"sync"
+)
+
+// 进度统计，将已处理的字节数报告给 Options.OnProgress，可被多个协程同时使用
+type progress struct {
+	mu     sync.Mutex
+	report func(entry string, bytesDone, bytesTotal int64)
+	total  int64
+	done   int64
+}
+
+// 创建进度统计，report 为 nil 时返回 nil（不统计进度）
+func newProgress(report func(entry string, bytesDone, bytesTotal int64), total int64) *progress {
+	if report == nil {
+		return nil
+	}
+	return &progress{report: report, total: total}
+}
+
+// 累加条目 entry 已处理的字节数并报告
+func (p *progress) add(entry string, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	p.report(entry, p.done, p.total)
+}
+
+// 全部处理完成，以空的条目名和 bytesDone == bytesTotal 最后报告一次
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report("", p.total, p.total)
+}
+
+// 读取时累加进度的 Reader，name 为当前处理的条目名
+type progressReader struct {
+	reader   io.Reader
+	progress *progress
+	name     string
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.progress.add(r.name, int64(n))
+	return n, err
+}
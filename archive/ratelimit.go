@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// 令牌桶限速器，限制复制内容的字节速率，并行压缩或解压的各个协程共用一个
+// 桶的容量为一秒的字节数，令牌不足时先预支，再等待到令牌补足为止
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// 返回每秒 rate 字节的限速器，rate 小于等于 0 时返回 nil（不限速）
+func newRateLimiter(rate int64) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// 取用 n 字节的令牌，令牌不足时等待，ctx 取消后返回 ctx.Err()
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 读取后按读到的字节数限速的 Reader
+type rateReader struct {
+	ctx     context.Context
+	limiter *rateLimiter
+	reader  io.Reader
+}
+
+func (r *rateReader) Read(b []byte) (int, error) {
+	// 单次读取不超过一秒的字节数，低速率时也能匀速复制
+	if rate := int(r.limiter.rate); len(b) > rate {
+		b = b[:rate]
+	}
+	n, err := r.reader.Read(b)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package archive
+
+// 其他平台不检查可用空间
+func availableSpace(path string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package archive
+
+import "syscall"
+
+// 获取 path 所在文件系统对当前用户可用的字节数
+func availableSpace(path string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, false
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true
+}
@@ -0,0 +1,779 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 分卷 ZIP 遵循 PKWARE APPNOTE 8.5 节的分卷（split）格式，与 Info-ZIP zip -s、WinZip、7-Zip 的分卷相同：
+//
+//   - 各卷依次命名为 archive.z01、archive.z02……，最后一卷为 archive.zip（超过 99 卷时为 archive.z100 等）
+//   - 第一卷以分卷标记 0x08074b50 开头，结果只有一卷时改为单卷标记 0x30304b50
+//   - 中央目录的每条记录保存本地文件头所在的卷号和在该卷内的偏移；中央目录本身可以跨卷，
+//     每条记录不跨卷；结尾记录（含 zip64 结尾记录和定位器）整个位于最后一卷
+//
+// 条目数据和本地文件头按字节连续写入，可能跨卷。Info-ZIP unzip 不能直接读取分卷归档，
+// 可以用 zip -s 0 archive.zip --out full.zip 合并为普通 ZIP
+const (
+	splitSignature       = 0x08074b50
+	splitSingleSignature = 0x30304b50
+
+	directoryHeaderSignature    = 0x02014b50
+	directoryEndSignature       = 0x06054b50
+	directory64EndSignature     = 0x06064b50
+	directory64LocatorSignature = 0x07064b50
+
+	directoryHeaderLen    = 46
+	directoryEndLen       = 22
+	directory64EndLen     = 56
+	directory64LocatorLen = 20
+
+	zip64ExtraID = 0x0001
+
+	// 分卷大小的下限，与 Info-ZIP zip -s 相同
+	minSplitSize = 64 << 10
+	// 卷号以 16 位记录，0xffff 保留给 zip64
+	maxVolumes = 0xfffe
+)
+
+var errDirectoryRecord = errors.New("无效的中央目录记录")
+
+// 第 i 卷（从 1 开始）的文件名，最后一卷不使用此名称而是 target 本身
+func volumeName(target string, i int) string {
+	return strings.TrimSuffix(target, filepath.Ext(target)) + fmt.Sprintf(".z%02d", i)
+}
+
+// 分卷压缩：依次写入 target 的各卷，zip.Writer 写出的中央目录截取下来按分卷格式改写后再写入
+func compressSplit(sources, prefixes []string, level int, target string, opts Options) (result *Result, err error) {
+	w, err := newVolumeWriter(target, opts.TempDir, opts.SplitSize)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			w.remove()
+		}
+	}()
+
+	var signature [4]byte
+	binary.LittleEndian.PutUint32(signature[:], splitSignature)
+	if _, err := w.Write(signature[:]); err != nil {
+		return nil, err
+	}
+
+	c := newCompressor(w, level, opts)
+	// zip.Writer 记录的偏移从第一卷开头算起，包含分卷标记，改写时再换算为各卷内的偏移
+	c.archive.SetOffset(int64(len(signature)))
+	if err := c.archive.SetComment(opts.Comment); err != nil {
+		return nil, err
+	}
+	if result, err = c.addSources(sources, prefixes); err != nil {
+		return nil, err
+	}
+
+	w.capture = &bytes.Buffer{}
+	if err := c.archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := w.writeDirectory(w.capture.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.close(); err != nil {
+		return nil, err
+	}
+
+	result.ArchiveBytes = w.offset
+	result.Volumes = w.names
+	return result, nil
+}
+
+// 分卷写入器：当前卷写满 size 字节后换到下一卷。各卷先写入临时文件，全部写完后才依次重命名为
+// .z01、.z02……，最后一卷重命名为 target，中途失败不会留下不完整的分卷，也不影响同名的已有分卷
+type volumeWriter struct {
+	target string
+	// 临时文件所在的文件夹，为空时与 target 在同一文件夹
+	tempDir string
+	size    int64
+	file    *os.File
+	// 已创建的各卷的临时文件名，最后一个是正在写入的卷；close 之后为各卷最终的文件名
+	names []string
+	// 各卷开头在整个归档中的偏移
+	starts []int64
+	// 当前卷已写入的字节数
+	used int64
+	// 整个归档已写入的字节数
+	offset int64
+	// 不为 nil 时写入的数据暂存于此，用于截取 zip.Writer 写出的中央目录
+	capture *bytes.Buffer
+}
+
+// 分卷的临时文件名的前缀，与 writeFileAtomic 的临时文件相同以 . 开头
+func volumeTempPrefix(target string) string {
+	return "." + filepath.Base(target) + ".tmp-"
+}
+
+func newVolumeWriter(target, tempDir string, size int64) (*volumeWriter, error) {
+	w := &volumeWriter{target: target, tempDir: tempDir, size: size}
+	if err := w.next(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// 关闭当前卷，开始写入下一卷
+func (w *volumeWriter) next() error {
+	if w.file != nil {
+		err := w.file.Close()
+		w.file = nil
+		if err != nil {
+			return err
+		}
+	}
+	if len(w.names) >= maxVolumes {
+		return fmt.Errorf("分卷数超过 %d，请增大分卷大小", maxVolumes)
+	}
+
+	dir := w.tempDir
+	if dir == "" {
+		dir = filepath.Dir(w.target)
+	}
+	file, err := ioutil.TempFile(dir, volumeTempPrefix(w.target))
+	if err != nil {
+		return err
+	}
+	w.file = file
+	w.names = append(w.names, file.Name())
+	w.starts = append(w.starts, w.offset)
+	w.used = 0
+	return nil
+}
+
+func (w *volumeWriter) Write(b []byte) (int, error) {
+	if w.capture != nil {
+		return w.capture.Write(b)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		if w.used == w.size {
+			if err := w.next(); err != nil {
+				return written, err
+			}
+		}
+		chunk := b
+		if room := w.size - w.used; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := w.file.Write(chunk)
+		written += n
+		w.used += int64(n)
+		w.offset += int64(n)
+		b = b[n:]
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// 保证接下来的 n 字节写在同一卷中，当前卷放不下时换到下一卷
+func (w *volumeWriter) reserve(n int) error {
+	if int64(n) > w.size {
+		return fmt.Errorf("分卷大小 %d 字节放不下 %d 字节的中央目录记录", w.size, n)
+	}
+	if w.used+int64(n) > w.size {
+		return w.next()
+	}
+	return nil
+}
+
+// 整个归档中的偏移所在的卷号（从 0 开始）和卷内偏移
+func (w *volumeWriter) locate(offset int64) (int, int64) {
+	disk := sort.Search(len(w.starts), func(i int) bool { return w.starts[i] > offset }) - 1
+	return disk, offset - w.starts[disk]
+}
+
+// 改写关闭 zip.Writer 时写出的数据 tail 并写入各卷：zip.Writer 先写完最后一个条目剩余的数据，
+// 再写中央目录和结尾记录。每条目录记录中的本地文件头偏移换算为卷号和卷内偏移，结尾记录按分卷格式重新生成
+func (w *volumeWriter) writeDirectory(tail []byte) error {
+	w.capture = nil
+
+	// 原结尾记录中只需要取出中央目录的位置和归档注释
+	parsed, err := parseDirectoryEnd(tail)
+	if err != nil {
+		return err
+	}
+	dirOffset := parsed.dirOffset
+	endPos := len(tail) - len(parsed.comment) - directoryEndLen
+	if end64Pos := endPos - directory64LocatorLen - directory64EndLen; dirOffset == 0xffffffff && end64Pos >= 0 &&
+		binary.LittleEndian.Uint32(tail[end64Pos:]) == directory64EndSignature {
+		dirOffset = binary.LittleEndian.Uint64(tail[end64Pos+48:])
+	}
+	start := int64(dirOffset) - w.offset
+	if start < 0 || start > int64(endPos) {
+		return errors.New("无效的中央目录位置")
+	}
+	if _, err := w.Write(tail[:start]); err != nil {
+		return err
+	}
+	tail = tail[start:]
+
+	end := &directoryEnd{comment: parsed.comment}
+	diskRecords := make(map[int]uint64)
+	first := true
+	for len(tail) >= 4 && binary.LittleEndian.Uint32(tail) == directoryHeaderSignature {
+		n, err := directoryRecordLen(tail)
+		if err != nil {
+			return err
+		}
+		record := tail[:n]
+		tail = tail[n:]
+
+		offset, ok := directoryOffset(record)
+		if !ok {
+			return errDirectoryRecord
+		}
+		disk, rel := w.locate(int64(offset))
+		binary.LittleEndian.PutUint16(record[34:], uint16(disk))
+		// 卷内偏移不大于原偏移，原来能记录的位置一定放得下
+		record = setDirectoryOffset(record, uint64(rel))
+
+		if err := w.reserve(len(record)); err != nil {
+			return err
+		}
+		if first {
+			end.dirDisk, end.dirOffset = uint32(len(w.names)-1), uint64(w.used)
+			first = false
+		}
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		diskRecords[len(w.names)-1]++
+		end.records++
+		end.dirSize += uint64(len(record))
+	}
+	if first {
+		end.dirDisk, end.dirOffset = uint32(len(w.names)-1), uint64(w.used)
+	}
+
+	if err := w.reserve(end.len()); err != nil {
+		return err
+	}
+	end.disk = uint32(len(w.names) - 1)
+	end.disks = uint32(len(w.names))
+	end.diskRecords = diskRecords[len(w.names)-1]
+	_, err = w.Write(end.bytes(uint64(w.used)))
+	return err
+}
+
+// 关闭最后一卷，把各卷的临时文件依次重命名为 .z01、.z02……，最后一卷重命名为 target；
+// 只有一卷时把开头的分卷标记改为单卷标记。target 最后替换，重命名中途失败时已有的 target 不变
+func (w *volumeWriter) close() error {
+	if len(w.names) == 1 {
+		var signature [4]byte
+		binary.LittleEndian.PutUint32(signature[:], splitSingleSignature)
+		if _, err := w.file.WriteAt(signature[:], 0); err != nil {
+			return err
+		}
+	}
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+
+	final := make([]string, len(w.names))
+	for i := range w.names {
+		final[i] = volumeName(w.target, i+1)
+	}
+	final[len(final)-1] = w.target
+	for i, temp := range w.names {
+		// TempFile 以 0600 创建
+		if err := os.Chmod(temp, 0644); err != nil {
+			return err
+		}
+		err := os.Rename(temp, final[i])
+		if err != nil && w.tempDir != "" {
+			err = copyRename(temp, final[i], 0644)
+		}
+		if err != nil {
+			return err
+		}
+		w.names[i] = final[i]
+	}
+
+	removeStaleVolumes(w.target, len(w.names))
+	return nil
+}
+
+// 删除之前分卷压缩到同一 target 时留下的多余分卷：本次共 volumes 卷，最后一卷即 target，
+// 因此从第 volumes 卷起都是多余的。之前的分卷中间可能有缺失，按文件夹中的文件名逐个检查，
+// 不在遇到第一个不存在的分卷时停止
+func removeStaleVolumes(target string, volumes int) {
+	dir := filepath.Dir(target)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	prefix := strings.TrimSuffix(filepath.Base(target), filepath.Ext(target)) + ".z"
+	for _, info := range infos {
+		digits := strings.TrimPrefix(info.Name(), prefix)
+		if digits == info.Name() || !info.Mode().IsRegular() {
+			continue
+		}
+		i, err := strconv.Atoi(digits)
+		if err != nil || i < volumes || filepath.Base(volumeName(target, i)) != info.Name() {
+			continue
+		}
+		os.Remove(filepath.Join(dir, info.Name()))
+	}
+}
+
+// 出错时删除尚未重命名的临时文件
+func (w *volumeWriter) remove() {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+	for _, name := range w.names {
+		if strings.HasPrefix(filepath.Base(name), volumeTempPrefix(w.target)) {
+			os.Remove(name)
+		}
+	}
+}
+
+// 中央目录结尾记录（含 zip64 结尾记录和定位器）中的信息
+type directoryEnd struct {
+	disk        uint32 // 结尾记录所在的卷号，即最后一卷
+	disks       uint32 // 总卷数
+	dirDisk     uint32 // 中央目录开始的卷号
+	diskRecords uint64 // 最后一卷中的目录记录数
+	records     uint64
+	dirSize     uint64
+	dirOffset   uint64 // 中央目录在开始的卷内的偏移
+	comment     []byte
+}
+
+// 是否需要 zip64 结尾记录
+func (d *directoryEnd) zip64() bool {
+	return d.records >= 0xffff || d.dirSize >= 0xffffffff || d.dirOffset >= 0xffffffff
+}
+
+// 生成的结尾记录的长度
+func (d *directoryEnd) len() int {
+	n := directoryEndLen + len(d.comment)
+	if d.zip64() {
+		n += directory64EndLen + directory64LocatorLen
+	}
+	return n
+}
+
+// 生成结尾记录，offset 为其在所在卷中的偏移
+func (d *directoryEnd) bytes(offset uint64) []byte {
+	b := make([]byte, 0, d.len())
+	le := binary.LittleEndian
+	records, diskRecords, size, dirOffset := d.records, d.diskRecords, d.dirSize, d.dirOffset
+	if d.zip64() {
+		var end [directory64EndLen]byte
+		le.PutUint32(end[0:], directory64EndSignature)
+		le.PutUint64(end[4:], directory64EndLen-12)
+		le.PutUint16(end[12:], 45)
+		le.PutUint16(end[14:], 45)
+		le.PutUint32(end[16:], d.disk)
+		le.PutUint32(end[20:], d.dirDisk)
+		le.PutUint64(end[24:], d.diskRecords)
+		le.PutUint64(end[32:], d.records)
+		le.PutUint64(end[40:], d.dirSize)
+		le.PutUint64(end[48:], d.dirOffset)
+		b = append(b, end[:]...)
+
+		var locator [directory64LocatorLen]byte
+		le.PutUint32(locator[0:], directory64LocatorSignature)
+		le.PutUint32(locator[4:], d.disk)
+		le.PutUint64(locator[8:], offset)
+		le.PutUint32(locator[16:], d.disks)
+		b = append(b, locator[:]...)
+
+		records, diskRecords, size, dirOffset = 0xffff, 0xffff, 0xffffffff, 0xffffffff
+	}
+
+	var end [directoryEndLen]byte
+	le.PutUint32(end[0:], directoryEndSignature)
+	le.PutUint16(end[4:], uint16(d.disk))
+	le.PutUint16(end[6:], uint16(d.dirDisk))
+	le.PutUint16(end[8:], uint16(diskRecords))
+	le.PutUint16(end[10:], uint16(records))
+	le.PutUint32(end[12:], uint32(size))
+	le.PutUint32(end[16:], uint32(dirOffset))
+	le.PutUint16(end[20:], uint16(len(d.comment)))
+	b = append(b, end[:]...)
+	return append(b, d.comment...)
+}
+
+// 从 b 中找到并解析结尾记录（不含 zip64 部分），b 为归档末尾的数据
+func parseDirectoryEnd(b []byte) (*directoryEnd, error) {
+	le := binary.LittleEndian
+	for i := len(b) - directoryEndLen; i >= 0; i-- {
+		if le.Uint32(b[i:]) != directoryEndSignature {
+			continue
+		}
+		commentLen := int(le.Uint16(b[i+20:]))
+		if i+directoryEndLen+commentLen > len(b) {
+			continue
+		}
+		return &directoryEnd{
+			disk:        uint32(le.Uint16(b[i+4:])),
+			dirDisk:     uint32(le.Uint16(b[i+6:])),
+			diskRecords: uint64(le.Uint16(b[i+8:])),
+			records:     uint64(le.Uint16(b[i+10:])),
+			dirSize:     uint64(le.Uint32(b[i+12:])),
+			dirOffset:   uint64(le.Uint32(b[i+16:])),
+			comment:     b[i+directoryEndLen : i+directoryEndLen+commentLen],
+		}, nil
+	}
+	return nil, errors.New("找不到中央目录结尾记录")
+}
+
+// 读取 r（大小为 size）末尾的结尾记录，有 zip64 结尾记录时以其中的值为准
+func readDirectoryEnd(r io.ReaderAt, size int64) (*directoryEnd, int64, error) {
+	tailLen := int64(directoryEndLen + 0xffff)
+	if tailLen > size {
+		tailLen = size
+	}
+	tail := make([]byte, tailLen)
+	if _, err := r.ReadAt(tail, size-tailLen); err != nil {
+		return nil, 0, err
+	}
+	end, err := parseDirectoryEnd(tail)
+	if err != nil {
+		return nil, 0, err
+	}
+	endOffset := size - tailLen + int64(len(tail)-len(end.comment)-directoryEndLen)
+	end.disks = end.disk + 1
+
+	// zip64 定位器紧挨在结尾记录之前，指向最后一卷中的 zip64 结尾记录
+	le := binary.LittleEndian
+	locatorOffset := endOffset - directory64LocatorLen
+	if locatorOffset < 0 {
+		return end, endOffset, nil
+	}
+	var locator [directory64LocatorLen]byte
+	if _, err := r.ReadAt(locator[:], locatorOffset); err != nil || le.Uint32(locator[:]) != directory64LocatorSignature {
+		return end, endOffset, nil
+	}
+	var end64 [directory64EndLen]byte
+	if _, err := r.ReadAt(end64[:], int64(le.Uint64(locator[8:]))); err != nil {
+		return nil, 0, err
+	}
+	if le.Uint32(end64[:]) != directory64EndSignature {
+		return nil, 0, errors.New("无效的 zip64 结尾记录")
+	}
+	end.disks = le.Uint32(locator[16:])
+	end.disk = le.Uint32(end64[16:])
+	end.dirDisk = le.Uint32(end64[20:])
+	end.diskRecords = le.Uint64(end64[24:])
+	end.records = le.Uint64(end64[32:])
+	end.dirSize = le.Uint64(end64[40:])
+	end.dirOffset = le.Uint64(end64[48:])
+	return end, endOffset, nil
+}
+
+// 中央目录记录的总长度（含文件名、扩展字段和注释）
+func directoryRecordLen(b []byte) (int, error) {
+	if len(b) < directoryHeaderLen || binary.LittleEndian.Uint32(b) != directoryHeaderSignature {
+		return 0, errDirectoryRecord
+	}
+	n := directoryHeaderLen + int(binary.LittleEndian.Uint16(b[28:])) +
+		int(binary.LittleEndian.Uint16(b[30:])) + int(binary.LittleEndian.Uint16(b[32:]))
+	if len(b) < n {
+		return 0, errDirectoryRecord
+	}
+	return n, nil
+}
+
+// 目录记录中 zip64 扩展字段里保存本地文件头偏移的 8 个字节，没有时返回 nil
+// zip64 扩展字段依次为原始大小、压缩后大小和偏移，只包含目录记录中记为 0xffffffff 的字段
+func zip64OffsetField(record []byte) []byte {
+	le := binary.LittleEndian
+	if le.Uint32(record[42:]) != 0xffffffff {
+		return nil
+	}
+	nameLen := int(le.Uint16(record[28:]))
+	extra := record[directoryHeaderLen+nameLen : directoryHeaderLen+nameLen+int(le.Uint16(record[30:]))]
+	for len(extra) >= 4 {
+		id := le.Uint16(extra[0:])
+		size := int(le.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return nil
+		}
+		data := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zip64ExtraID {
+			continue
+		}
+		for _, field := range []int{24, 20} {
+			if le.Uint32(record[field:]) == 0xffffffff && len(data) >= 8 {
+				data = data[8:]
+			}
+		}
+		if len(data) < 8 {
+			return nil
+		}
+		return data[:8]
+	}
+	return nil
+}
+
+// 目录记录中的本地文件头偏移
+func directoryOffset(record []byte) (uint64, bool) {
+	offset := uint64(binary.LittleEndian.Uint32(record[42:]))
+	if offset != 0xffffffff {
+		return offset, true
+	}
+	field := zip64OffsetField(record)
+	if field == nil {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(field), true
+}
+
+// 设置目录记录中的本地文件头偏移，返回设置后的记录：
+// 原来以 zip64 扩展字段记录的仍写在扩展字段中，否则 32 位放得下时直接写入，放不下时加入 zip64 扩展字段
+func setDirectoryOffset(record []byte, offset uint64) []byte {
+	le := binary.LittleEndian
+	if field := zip64OffsetField(record); field != nil {
+		le.PutUint64(field, offset)
+		return record
+	}
+	if offset < 0xffffffff {
+		le.PutUint32(record[42:], uint32(offset))
+		return record
+	}
+
+	// 在已有的 zip64 扩展字段末尾追加偏移，没有时新增一个
+	nameLen := int(le.Uint16(record[28:]))
+	extraLen := int(le.Uint16(record[30:]))
+	extra := record[directoryHeaderLen+nameLen : directoryHeaderLen+nameLen+extraLen]
+	var newExtra []byte
+	found := false
+	for len(extra) >= 4 {
+		id := le.Uint16(extra[0:])
+		size := int(le.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[:4+size]
+		extra = extra[4+size:]
+		if id == zip64ExtraID && !found {
+			found = true
+			field = append(append([]byte(nil), field...), make([]byte, 8)...)
+			le.PutUint16(field[2:], uint16(size+8))
+			le.PutUint64(field[4+size:], offset)
+		}
+		newExtra = append(newExtra, field...)
+	}
+	if !found {
+		var field [12]byte
+		le.PutUint16(field[0:], zip64ExtraID)
+		le.PutUint16(field[2:], 8)
+		le.PutUint64(field[4:], offset)
+		newExtra = append(newExtra, field[:]...)
+	}
+
+	out := make([]byte, 0, len(record)-extraLen+len(newExtra))
+	out = append(out, record[:directoryHeaderLen+nameLen]...)
+	out = append(out, newExtra...)
+	out = append(out, record[directoryHeaderLen+nameLen+extraLen:]...)
+	le.PutUint32(out[42:], 0xffffffff)
+	le.PutUint16(out[30:], uint16(len(newExtra)))
+	return out
+}
+
+// 分卷归档的各卷拼接成的 io.ReaderAt：依次为各卷中位于中央目录之前的数据，
+// 之后是改写为单卷格式的中央目录和结尾记录，可以直接交给 zip.NewReader 读取
+type volumeReader struct {
+	files []*os.File
+	parts []volumePart
+	size  int64
+}
+
+// volumeReader 中的一段数据，start 为其在拼接后的数据中的偏移
+type volumePart struct {
+	reader io.ReaderAt
+	start  int64
+	size   int64
+}
+
+// 打开 source 处的分卷归档：source 是最后一卷（如 archive.zip），按其结尾记录中的卷数打开同目录下的
+// archive.z01 等各卷。source 不是分卷归档或无法按 ZIP 解析时返回 nil，由调用方按普通归档处理
+func openSplit(source string) (*volumeReader, error) {
+	last, err := os.Open(source)
+	if err != nil {
+		return nil, nil
+	}
+	info, err := last.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		last.Close()
+		return nil, nil
+	}
+	end, _, err := readDirectoryEnd(last, info.Size())
+	if err != nil || end.disks <= 1 {
+		last.Close()
+		return nil, nil
+	}
+	// 卷数来自归档末尾的记录，可能是伪造的：超过格式上限或与最后一卷的卷号不符时不按分卷读取
+	if end.disks > maxVolumes || end.disk != end.disks-1 {
+		last.Close()
+		return nil, fmt.Errorf("%s 记录的分卷数 %d 无效，归档可能已损坏", source, end.disks)
+	}
+
+	// 逐卷打开，缺少分卷时在读取之前就报错
+	r := &volumeReader{}
+	var starts []int64
+	var offset int64
+	for i := 0; i < int(end.disks); i++ {
+		file := last
+		if i < int(end.disks)-1 {
+			name := volumeName(source, i+1)
+			if file, err = os.Open(name); err != nil {
+				r.files = append(r.files, last)
+				r.Close()
+				if os.IsNotExist(err) {
+					return nil, fmt.Errorf("缺少分卷 %s（共 %d 卷，应放在同一文件夹中）", name, end.disks)
+				}
+				return nil, err
+			}
+		}
+		r.files = append(r.files, file)
+		stat, err := file.Stat()
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		starts = append(starts, offset)
+		r.parts = append(r.parts, volumePart{reader: file, start: offset, size: stat.Size()})
+		offset += stat.Size()
+	}
+	r.size = offset
+
+	if err := r.rewriteDirectory(end, starts, source); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// 读出跨卷的中央目录，把每条记录中的卷号和卷内偏移换算为拼接后的偏移，
+// 再把 r 改为只包含中央目录之前的数据和改写后的中央目录
+func (r *volumeReader) rewriteDirectory(end *directoryEnd, starts []int64, source string) error {
+	if end.dirDisk >= end.disks {
+		return fmt.Errorf("%s 的中央目录位置无效", source)
+	}
+	dirStart := starts[end.dirDisk] + int64(end.dirOffset)
+	if end.dirSize > uint64(r.size) || dirStart+int64(end.dirSize) > r.size {
+		return fmt.Errorf("%s 的中央目录超出分卷范围，分卷可能不完整", source)
+	}
+	dir := make([]byte, end.dirSize)
+	if _, err := r.ReadAt(dir, dirStart); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for i := uint64(0); i < end.records; i++ {
+		n, err := directoryRecordLen(dir)
+		if err != nil {
+			return err
+		}
+		record := dir[:n]
+		dir = dir[n:]
+
+		disk := binary.LittleEndian.Uint16(record[34:])
+		offset, ok := directoryOffset(record)
+		if !ok || uint32(disk) >= end.disks {
+			return errDirectoryRecord
+		}
+		binary.LittleEndian.PutUint16(record[34:], 0)
+		out.Write(setDirectoryOffset(record, uint64(starts[disk])+offset))
+	}
+
+	single := &directoryEnd{
+		disks:       1,
+		diskRecords: end.records,
+		records:     end.records,
+		dirSize:     uint64(out.Len()),
+		dirOffset:   uint64(dirStart),
+		comment:     end.comment,
+	}
+	out.Write(single.bytes(uint64(dirStart) + single.dirSize))
+
+	// 只保留中央目录之前的数据，后面接上改写后的中央目录
+	var parts []volumePart
+	for _, part := range r.parts {
+		if part.start >= dirStart {
+			break
+		}
+		if part.start+part.size > dirStart {
+			part.size = dirStart - part.start
+		}
+		parts = append(parts, part)
+	}
+	parts = append(parts, volumePart{reader: bytes.NewReader(out.Bytes()), start: dirStart, size: int64(out.Len())})
+	r.parts = parts
+	r.size = dirStart + int64(out.Len())
+	return nil
+}
+
+func (r *volumeReader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("无效的偏移")
+	}
+	n := 0
+	for _, part := range r.parts {
+		if len(b) == 0 {
+			break
+		}
+		end := part.start + part.size
+		if off >= end {
+			continue
+		}
+		chunk := b
+		if int64(len(chunk)) > end-off {
+			chunk = chunk[:end-off]
+		}
+		m, err := part.reader.ReadAt(chunk, off-part.start)
+		n += m
+		off += int64(m)
+		b = b[m:]
+		if m < len(chunk) {
+			if err == nil || err == io.EOF {
+				// 分卷在读取过程中被截短
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+	}
+	if len(b) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 关闭各卷
+func (r *volumeReader) Close() error {
+	var err error
+	for _, file := range r.files {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,244 @@
+package archive
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 大于若干卷、不可压缩的测试数据
+func randomData(n int) string {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(data)
+	return string(data)
+}
+
+func TestSplitRoundTrip(t *testing.T) {
+	for _, jobs := range []int{1, 4} {
+		dir := t.TempDir()
+		files := sampleFiles()
+		files["big.bin"] = randomData(3*minSplitSize + 123)
+		source := writeTestTree(t, filepath.Join(dir, "src"), files)
+		target := filepath.Join(dir, "out.zip")
+
+		result, err := Compress([]string{source}, target, Options{SplitSize: minSplitSize, Jobs: jobs, Comment: "note"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Volumes) < 4 || result.Volumes[len(result.Volumes)-1] != target {
+			t.Fatalf("jobs=%d: 分卷不正确: %v", jobs, result.Volumes)
+		}
+		for _, name := range result.Volumes {
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() > minSplitSize {
+				t.Fatalf("分卷 %s 超过分卷大小: %d", name, info.Size())
+			}
+		}
+
+		reader, err := OpenZip(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reader.Split || reader.Comment != "note" {
+			t.Errorf("jobs=%d: Split=%v Comment=%q", jobs, reader.Split, reader.Comment)
+		}
+		reader.Close()
+
+		out := filepath.Join(dir, "out")
+		if _, err := Extract(target, out, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		assertTree(t, out, files)
+	}
+}
+
+// 结果只有一卷时写为单卷标记开头的普通 ZIP
+func TestSplitSingleVolume(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), sampleFiles())
+	target := filepath.Join(dir, "one.zip")
+	result, err := Compress([]string{source}, target, Options{SplitSize: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Volumes) != 1 {
+		t.Fatalf("应当只有一卷: %v", result.Volumes)
+	}
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(data) != splitSingleSignature {
+		t.Fatalf("开头应为单卷标记: % x", data[:4])
+	}
+	out := filepath.Join(dir, "out")
+	if _, err := Extract(target, out, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, out, sampleFiles())
+}
+
+func TestSplitMissingVolume(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"big.bin": randomData(3 * minSplitSize)})
+	target := filepath.Join(dir, "out.zip")
+	if _, err := Compress([]string{source}, target, Options{SplitSize: minSplitSize}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(volumeName(target, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenZip(target); err == nil {
+		t.Fatal("缺少分卷时应当报错")
+	}
+	if _, err := Extract(target, filepath.Join(dir, "out"), Options{}); err == nil {
+		t.Fatal("缺少分卷时应当报错")
+	}
+}
+
+// zip64 定位器中伪造的卷数不能导致按卷数分配内存
+func TestSplitRejectsBogusVolumeCount(t *testing.T) {
+	le := binary.LittleEndian
+	data := make([]byte, directory64EndLen+directory64LocatorLen+directoryEndLen)
+	end64 := data[:directory64EndLen]
+	le.PutUint32(end64[0:], directory64EndSignature)
+	le.PutUint64(end64[4:], directory64EndLen-12)
+	le.PutUint32(end64[16:], 0xfffffffe)
+	locator := data[directory64EndLen:]
+	le.PutUint32(locator[0:], directory64LocatorSignature)
+	le.PutUint32(locator[16:], 0xffffffff)
+	end := data[directory64EndLen+directory64LocatorLen:]
+	le.PutUint32(end[0:], directoryEndSignature)
+	for i := 4; i < 20; i++ {
+		end[i] = 0xff
+	}
+
+	path := filepath.Join(t.TempDir(), "bogus.zip")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenZip(path); err == nil {
+		t.Fatal("伪造的卷数应当报错")
+	}
+	if _, err := Extract(path, filepath.Join(t.TempDir(), "out"), Options{}); err == nil {
+		t.Fatal("伪造的卷数应当报错")
+	}
+}
+
+func TestSplitOptionValidation(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), sampleFiles())
+	cases := []Options{
+		{SplitSize: 1024},
+		{SplitSize: minSplitSize, Format: FormatTarGz},
+		{SplitSize: minSplitSize, SFXStub: filepath.Join(dir, "stub")},
+	}
+	for _, opts := range cases {
+		if _, err := Compress([]string{source}, filepath.Join(dir, "x.zip"), opts); err == nil {
+			t.Errorf("%+v 应当报错", opts)
+		}
+	}
+	if _, err := CompressTo([]string{source}, ioutil.Discard, Options{SplitSize: minSplitSize}); err == nil {
+		t.Error("CompressTo 不能分卷")
+	}
+}
+
+// 中途失败时删除各卷的临时文件，之前写出的同名分卷保持不变
+func TestSplitFailureKeepsExistingVolumes(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"big.bin": randomData(3 * minSplitSize)})
+	target := filepath.Join(dir, "out.zip")
+	first, err := Compress([]string{source}, target, Options{SplitSize: minSplitSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := make(map[string]string)
+	for _, name := range first.Volumes {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[name] = string(data)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := Options{SplitSize: minSplitSize, Context: ctx, Level: LevelStore}
+	opts.OnProgress = func(entry string, done, total int64) {
+		if done > minSplitSize {
+			cancel()
+		}
+	}
+	writeTestTree(t, source, map[string]string{"more.bin": randomData(4 * minSplitSize)})
+	if _, err := Compress([]string{source}, target, opts); err == nil {
+		t.Fatal("取消后应当报错")
+	}
+
+	for name, data := range before {
+		got, err := ioutil.ReadFile(name)
+		if err != nil || string(got) != data {
+			t.Fatalf("已有分卷 %s 被改动: %v", name, err)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), volumeTempPrefix(target)) {
+			t.Fatalf("留下了临时文件 %s", entry.Name())
+		}
+	}
+	if _, err := os.Stat(volumeName(target, len(first.Volumes))); !os.IsNotExist(err) {
+		t.Fatalf("不应写出多余的分卷: %v", err)
+	}
+}
+
+// 以更少的分卷重新压缩到同一 target 时删除之前多余的分卷，之前的分卷中间有缺失时也不遗漏
+func TestSplitRecompressRemovesStaleVolumes(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestTree(t, filepath.Join(dir, "src"), map[string]string{"big.bin": randomData(5 * minSplitSize)})
+	target := filepath.Join(dir, "out.zip")
+	first, err := Compress([]string{source}, target, Options{SplitSize: minSplitSize, Level: LevelStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Volumes) < 5 {
+		t.Fatalf("应当至少有 5 卷: %v", first.Volumes)
+	}
+	if err := os.Remove(volumeName(target, 3)); err != nil {
+		t.Fatal(err)
+	}
+	other := writeTestTree(t, dir, map[string]string{"out.txt": "other"})
+
+	files := map[string]string{"small.bin": randomData(minSplitSize + 100)}
+	source = writeTestTree(t, filepath.Join(dir, "src2"), files)
+	second, err := Compress([]string{source}, target, Options{SplitSize: minSplitSize, Level: LevelStore})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Volumes) != 2 {
+		t.Fatalf("应当有 2 卷: %v", second.Volumes)
+	}
+	for i := len(second.Volumes); i < len(first.Volumes); i++ {
+		if _, err := os.Stat(volumeName(target, i)); !os.IsNotExist(err) {
+			t.Errorf("多余的分卷 %s 没有删除: %v", volumeName(target, i), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(other, "out.txt")); err != nil {
+		t.Fatalf("无关的文件被删除: %v", err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if _, err := Extract(target, out, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	assertTree(t, out, files)
+}
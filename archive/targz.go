@@ -0,0 +1,180 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gzip 数据的魔数
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// 将所有源写入 tar 流并以 gzip 压缩后写入 w
+// tar 原样记录 Unix 权限和符号链接；level 与 gzip 的压缩级别取值相同
+func compressTarGz(sources, prefixes []string, level int, w io.Writer, opts Options) (result *Result, err error) {
+	gz, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	defer closeWith(gz, &err)
+
+	// tar.Writer 先于 gzip.Writer 关闭，写入的结尾块才会被压缩
+	tw := tar.NewWriter(gz)
+	defer closeWith(tw, &err)
+
+	var prog *progress
+	if opts.OnProgress != nil {
+		total, err := sourceSize(sources, prefixes, opts)
+		if err != nil {
+			return nil, err
+		}
+		prog = newProgress(opts.OnProgress, total)
+		defer prog.finish()
+	}
+
+	for _, dir := range opts.prefixDirs() {
+		header := &tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0755, ModTime: time.Now()}
+		if opts.Reproducible {
+			header.ModTime = opts.reproducibleTime()
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		opts.verbosef("  添加: %s\n", dir)
+	}
+
+	buffers := newBufferPool(opts)
+	result = &Result{}
+	err = walkSources(sources, prefixes, opts, result.skip, func(path, name string, info os.FileInfo) error {
+		var linkTarget string
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			linkTarget = filepath.ToSlash(target)
+		}
+
+		header, err := tar.FileInfoHeader(info, linkTarget)
+		if err != nil {
+			return err
+		}
+		header.Name = opts.entryName(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if opts.Reproducible {
+			header.ModTime = opts.reproducibleTime()
+			header.Uid, header.Gid = 0, 0
+			header.Uname, header.Gname = "", ""
+		}
+
+		// 文件在写入条目头之前打开，设置 KeepGoing 时打不开的文件不会留下空条目
+		var file *os.File
+		if info.Mode().IsRegular() {
+			file, err = os.Open(path)
+			if err != nil {
+				if opts.KeepGoing {
+					result.skip(header.Name, err)
+					return nil
+				}
+				return err
+			}
+			defer file.Close()
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			result.Files++
+			opts.verbosef("  添加: %s -> %s\n", header.Name, linkTarget)
+		case file != nil:
+			n, err := buffers.copy(tw, &progressReader{reader: file, progress: prog, name: header.Name})
+			result.Files++
+			result.Bytes += n
+			opts.verbosef("  添加: %s (%d 字节)\n", header.Name, n)
+			return err
+		default:
+			opts.verbosef("  添加: %s\n", header.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 从 r 流式解压 tar.gz 归档中的所有条目
+// tar.gz 无法预先得知解压后的总大小，进度按已读取的压缩数据占归档大小 size 的比例统计，size 为 0 表示未知
+func (e *extractor) extractTarGz(r io.Reader, size int64) error {
+	prog := newProgress(e.opts.OnProgress, size)
+	defer prog.finish()
+
+	// 读取压缩数据时统计进度，条目名在读到每个条目头后更新
+	counter := &progressReader{reader: r, progress: prog}
+	gz, err := gzip.NewReader(counter)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if !e.opts.DryRun {
+		if err := os.MkdirAll(e.target, 0755); err != nil {
+			return err
+		}
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		counter.name = header.Name
+
+		entry := extractEntry{
+			name:     header.Name,
+			mode:     header.FileInfo().Mode(),
+			modTime:  header.ModTime,
+			size:     header.Size,
+			uid:      header.Uid,
+			gid:      header.Gid,
+			hasOwner: true,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if !strings.HasSuffix(entry.name, "/") {
+				entry.name += "/"
+			}
+		case tar.TypeReg:
+			entry.open = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(tr), nil
+			}
+		case tar.TypeSymlink:
+			linkname := header.Linkname
+			entry.open = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader(linkname)), nil
+			}
+		default:
+			// 硬链接、设备文件等不解压
+			e.opts.verbosef("  跳过: %s (不支持的条目类型)\n", header.Name)
+			continue
+		}
+
+		if err := e.extract(entry); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// VerifyResult 单个条目的校验结果，Err 为 nil 表示校验通过
+type VerifyResult struct {
+	Name string
+	Err  error
+}
+
+// Verify 完整读取 source 中的每个文件条目，并将计算出的 CRC32 与记录值比对
+// 返回的 error 仅表示归档本身无法打开
+func Verify(source string) ([]VerifyResult, error) {
+	reader, err := OpenZip(source)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var results []VerifyResult
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		results = append(results, VerifyResult{Name: file.Name, Err: verifyEntry(file)})
+	}
+	return results, nil
+}
+
+// 校验单个条目
+func verifyEntry(file *zip.File) error {
+	fileReader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, fileReader); err != nil {
+		return err
+	}
+
+	if sum := hash.Sum32(); sum != file.CRC32 {
+		return fmt.Errorf("CRC32 不匹配: 记录值 %08x, 实际值 %08x", file.CRC32, sum)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 流式写入的测试条目
+var streamedFiles = []struct {
+	name string
+	body string
+}{
+	{"a.txt", "hello data descriptor"},
+	{"sub/b.txt", strings.Repeat("streamed entry\n", 8<<10)},
+}
+
+// 写出流式写入的 ZIP 归档：大小和 CRC 记录在条目数据之后的数据描述符中（通用标志第 3 位），
+// 本地文件头中的这些字段为 0。条目仅存储，便于测试中直接改动内容
+func writeStreamedZip(t *testing.T, dir string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	// 只实现 io.Writer，archive/zip 无法回填本地文件头，总是写入数据描述符
+	w := zip.NewWriter(struct{ io.Writer }{&buf})
+	for _, file := range streamedFiles {
+		writer, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(file.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "streamed.zip")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 解压和校验使用中央目录中记录的大小和 CRC，不依赖本地文件头
+func TestVerifyDataDescriptor(t *testing.T) {
+	dir := t.TempDir()
+	source := writeStreamedZip(t, dir)
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if flags := le.Uint16(data[6:]); flags&0x8 == 0 {
+		t.Fatalf("第一个条目没有使用数据描述符: flags=%04x", flags)
+	}
+	if crc, size := le.Uint32(data[14:]), le.Uint32(data[22:]); crc != 0 || size != 0 {
+		t.Fatalf("本地文件头中的 CRC 和大小应为 0: %08x %d", crc, size)
+	}
+
+	for _, jobs := range []int{1, 4} {
+		target := filepath.Join(dir, fmt.Sprintf("out%d", jobs))
+		if _, err := Extract(source, target, Options{Jobs: jobs}); err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range streamedFiles {
+			got, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(file.name)))
+			if err != nil || string(got) != file.body {
+				t.Errorf("jobs=%d: %s 的内容不正确: %v", jobs, file.name, err)
+			}
+		}
+	}
+	results, err := Verify(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			t.Errorf("%s 校验失败: %v", result.Name, result.Err)
+		}
+	}
+
+	// 改动条目内容后 CRC 不再匹配，解压报错且不留下该文件
+	i := bytes.Index(data, []byte(streamedFiles[0].body))
+	data[i] ^= 0xff
+	corrupt := filepath.Join(dir, "corrupt.zip")
+	if err := ioutil.WriteFile(corrupt, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "corrupt")
+	if _, err := Extract(corrupt, target, Options{}); err == nil {
+		t.Fatal("CRC 不匹配时应当报错")
+	}
+	if _, err := os.Stat(filepath.Join(target, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("不应留下内容错误的文件: %v", err)
+	}
+	results, err = Verify(corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Err == nil || results[1].Err != nil {
+		t.Errorf("只有 a.txt 应当校验失败: %+v", results)
+	}
+}
@@ -0,0 +1,22 @@
+package archive
+
+import (
+	"compress/flate"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstd 在 ZIP 中的压缩方法号（APPNOTE 6.3.7 起分配为 93）
+// 这样的 ZIP 只有 xzip 以及支持 zstd 的工具能够解压
+const zipMethodZstd = zstd.ZipMethodWinZip
+
+// 返回 zstd 条目的压缩器，level 为 flate 压缩级别，按大致相当的速度和压缩率映射为 zstd 的级别
+func newZstdWriter(level int) func(w io.Writer) (io.WriteCloser, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != flate.DefaultCompression {
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	// 并行压缩时每个条目已经各占一个协程，编码器本身不再并发
+	return zstd.ZipCompressor(zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+}
@@ -0,0 +1,65 @@
+// xzip-sfx 是 xzip 自解压文件的解压程序。
+//
+// xzip compress --sfx 把 ZIP 归档附加在本程序之后生成自解压文件，运行时解压自身附带的归档，
+// 不需要安装 xzip，也不需要授权：
+//
+//	report.exe               解压到当前目录下的 report 文件夹
+//	report.exe <目标文件夹>  解压到指定的文件夹
+//
+// xzip 在其所在目录按 xzip-sfx-<平台> 查找各平台的解压程序，编译方法：
+//
+//	GOOS=linux go build -o xzip-sfx-linux ./cmd/xzip-sfx
+//	GOOS=windows go build -o xzip-sfx-windows.exe ./cmd/xzip-sfx
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"xzip/archive"
+)
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 解压失败: %v\n", err)
+	}
+
+	// Windows 上双击运行时窗口会在退出后立即关闭，等待用户看到结果
+	if runtime.GOOS == "windows" {
+		fmt.Print("按回车键退出...")
+		bufio.NewReader(os.Stdin).ReadString('\n')
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// 默认解压到以自身文件名（去掉扩展名）命名的文件夹，没有扩展名时加上 _files 避免与自身重名
+	base := filepath.Base(exe)
+	target := strings.TrimSuffix(base, filepath.Ext(base))
+	if target == base {
+		target += "_files"
+	}
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	fmt.Printf("正在解压到 %s\n", target)
+	result, err := archive.Extract(exe, target, archive.Options{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ 解压完成: %d 个文件，保存在 %s\n", result.Files, target)
+	return nil
+}
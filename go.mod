@@ -2,6 +2,12 @@ module xzip
 
 go 1.19
 
-require golang.org/x/term v0.5.0
+require (
+	github.com/klauspost/compress v1.17.4
+	golang.org/x/term v0.5.0
+	golang.org/x/text v0.14.0
+)
 
-require golang.org/x/sys v0.5.0 // indirect
+require (
+	golang.org/x/sys v0.5.0 // indirect
+)
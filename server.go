@@ -17,6 +17,8 @@ type AuthRequest struct {
 
 type AuthResponse struct {
 	Status int `json:"status"`
+	// 授权失败的原因，显示给用户
+	Message string `json:"message,omitempty"`
 }
 
 type KeyInfo struct {
@@ -70,40 +72,40 @@ func generateRandomKey() string {
 	return hex.EncodeToString(bytes)
 }
 
-// 验证key的有效性
-func validateKey(key string) int {
+// 验证key的有效性，失败时同时返回原因
+func validateKey(key string) (int, string) {
 	dbMutex.Lock()
 	defer dbMutex.Unlock()
 
 	keyInfo, exists := keyDatabase[key]
 	if !exists {
 		log.Printf("Key不存在: %s", key)
-		return -1 // key不存在
+		return -1, "key不存在，请检查key是否输入正确"
 	}
 
 	// 检查key是否有效
 	if !keyInfo.Valid {
 		log.Printf("Key已禁用: %s", key)
-		return -1
+		return -1, "key已被吊销，请联系客服"
 	}
 
 	// 检查是否过期
 	if time.Now().After(keyInfo.ExpiresAt) {
 		log.Printf("Key已过期: %s", key)
-		return -1
+		return -1, fmt.Sprintf("key已于 %s 过期，请续费", keyInfo.ExpiresAt.Format("2006-01-02"))
 	}
 
 	// 检查使用次数限制
 	if keyInfo.UsageCount >= keyInfo.MaxUsage {
 		log.Printf("Key使用次数超限: %s (%d/%d)", key, keyInfo.UsageCount, keyInfo.MaxUsage)
-		return -1
+		return -1, fmt.Sprintf("key的使用次数已达上限 (%d 次)", keyInfo.MaxUsage)
 	}
 
 	// 增加使用计数
 	keyInfo.UsageCount++
 	
 	log.Printf("Key验证成功: %s (使用次数: %d/%d)", key, keyInfo.UsageCount, keyInfo.MaxUsage)
-	return 1 // 验证成功
+	return 1, "" // 验证成功
 }
 
 // 授权验证处理器
@@ -128,7 +130,7 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 	var authReq AuthRequest
 	if err := json.NewDecoder(r.Body).Decode(&authReq); err != nil {
 		log.Printf("JSON解析失败: %v", err)
-		response := AuthResponse{Status: -1}
+		response := AuthResponse{Status: -1, Message: "请求格式错误"}
 		json.NewEncoder(w).Encode(response)
 		return
 	}
@@ -142,9 +144,9 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("收到授权请求 - IP: %s, Key: %s", clientIP, authReq.Key)
 
 	// 验证key
-	status := validateKey(authReq.Key)
+	status, message := validateKey(authReq.Key)
 	
-	response := AuthResponse{Status: status}
+	response := AuthResponse{Status: status, Message: message}
 	
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("响应编码失败: %v", err)
@@ -2,21 +2,59 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
-	"crypto/tls"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"xzip/archive"
+)
+
+const (
+	AuthURL       = "https://xzip.com/authorize"
+	KeyFile       = ".xzip/key"
+	AuthCacheFile = ".xzip/auth_cache"
+
+	// 授权缓存默认有效期，可通过环境变量 XZIP_AUTH_CACHE_TTL 缩短（如 12h），不能超过默认值
+	DefaultAuthCacheTTL = 24 * time.Hour
+	// 连不上授权服务器时的默认离线宽限期：距上次联网验证成功不超过此时长则继续使用，
+	// 可通过环境变量 XZIP_AUTH_OFFLINE_GRACE 缩短，不能超过默认值，0 表示不允许离线使用
+	DefaultAuthOfflineGrace = 7 * 24 * time.Hour
+
+	// 授权请求默认超时时间，可通过 --auth-timeout 覆盖
+	DefaultAuthTimeout = 10 * time.Second
+	// 网络错误或服务器 5xx 时的最大尝试次数
+	AuthMaxAttempts = 3
 )
 
+// 进程退出码
 const (
-	AuthURL = "https://localhost:8443/authorize"  // 使用本地服务器
-	KeyFile = ".xzip/key"
+	ExitUsage  = 1 // 参数错误、未知命令
+	ExitAuth   = 2 // 授权失败（key缺失、授权被拒、授权请求失败）
+	ExitIO     = 3 // 压缩、解压等操作失败（文件读写错误、归档损坏等）
+	ExitVerify = 4 // test 发现校验失败的条目
+
+	ExitInterrupted = 130 // 被 Ctrl-C（SIGINT）或 SIGTERM 中断，与 shell 的约定一致
 )
 
 type AuthRequest struct {
@@ -25,192 +63,462 @@ type AuthRequest struct {
 
 type AuthResponse struct {
 	Status int `json:"status"`
+	// 服务器给出的说明，如key已过期、已吊销或超出使用次数，可能为空
+	Message string `json:"message,omitempty"`
 }
 
-// 获取用户home目录下的key文件路径
+// 本地授权缓存，只保存key的哈希，不保存key本身
+type AuthCache struct {
+	KeyHash     string    `json:"key_hash"`
+	ValidatedAt time.Time `json:"validated_at"`
+}
+
+// 获取key文件路径，指定了 --key-file 时使用指定的路径，否则为用户home目录下的 .xzip/key
 func getKeyFilePath() string {
+	if keyFileFlag != "" {
+		return keyFileFlag
+	}
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, KeyFile)
 }
 
 // 读取授权key
+// 优先级: --key-file 指定的文件 > 环境变量 XZIP_KEY（非空时）> 默认key文件
 func readAuthKey() (string, error) {
+	if key := strings.TrimSpace(os.Getenv("XZIP_KEY")); key != "" && keyFileFlag == "" {
+		logf(logInfo, "使用环境变量 XZIP_KEY 中的key")
+		return key, nil
+	}
+
 	keyPath := getKeyFilePath()
+	logf(logInfo, "使用key文件 %s", keyPath)
 	data, err := ioutil.ReadFile(keyPath)
 	if err != nil {
 		return "", fmt.Errorf("无法读取key文件 %s: %v", keyPath, err)
 	}
-	return strings.TrimSpace(string(data)), nil
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("key文件 %s 为空，请将授权key写入该文件，或运行 xzip auth set <key>", keyPath)
+	}
+	return key, nil
+}
+
+// 获取授权缓存文件路径
+func getAuthCachePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, AuthCacheFile)
+}
+
+// 授权缓存有效期
+func authCacheTTL() time.Duration {
+	if value := os.Getenv("XZIP_AUTH_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		switch {
+		case err != nil:
+			logf(logWarn, "无效的 XZIP_AUTH_CACHE_TTL: %s，使用默认值 %v", value, DefaultAuthCacheTTL)
+		case ttl > DefaultAuthCacheTTL:
+			logf(logWarn, "XZIP_AUTH_CACHE_TTL 不能超过 %v，使用 %v", DefaultAuthCacheTTL, DefaultAuthCacheTTL)
+		default:
+			return ttl
+		}
+	}
+	return DefaultAuthCacheTTL
 }
 
-// 验证服务器证书域名 (本地测试版本)
-func verifyServerCertificate(resp *http.Response) error {
-	if resp.TLS == nil {
-		return fmt.Errorf("连接不是HTTPS")
+// 离线宽限期
+func authOfflineGrace() time.Duration {
+	if value := os.Getenv("XZIP_AUTH_OFFLINE_GRACE"); value != "" {
+		grace, err := time.ParseDuration(value)
+		switch {
+		case err != nil:
+			logf(logWarn, "无效的 XZIP_AUTH_OFFLINE_GRACE: %s，使用默认值 %v", value, DefaultAuthOfflineGrace)
+		case grace > DefaultAuthOfflineGrace:
+			logf(logWarn, "XZIP_AUTH_OFFLINE_GRACE 不能超过 %v，使用 %v", DefaultAuthOfflineGrace, DefaultAuthOfflineGrace)
+		default:
+			return grace
+		}
 	}
-	
-	// 本地测试时，跳过域名验证
-	fmt.Println("⚠️  本地测试模式：跳过证书域名验证")
-	return nil
+	return DefaultAuthOfflineGrace
 }
 
-// 验证授权
-func validateAuth() error {
-	key, err := readAuthKey()
+// 计算key的哈希，用于缓存比对
+func hashAuthKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 读取授权缓存，key不匹配或文件损坏时返回错误
+func readAuthCache(key string) (*AuthCache, error) {
+	data, err := ioutil.ReadFile(getAuthCachePath())
 	if err != nil {
-		return fmt.Errorf("授权验证失败: %v", err)
+		return nil, err
 	}
 
-	fmt.Printf("🔑 使用Key: %s\n", key)
-	fmt.Printf("🌐 请求地址: %s\n", AuthURL)
+	var cache AuthCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	if cache.KeyHash != hashAuthKey(key) {
+		return nil, fmt.Errorf("缓存的key与当前key不一致")
+	}
+	// 验证时间在未来的缓存是被改过的，或者系统时间被调回过，都不能用来跳过验证
+	if cache.ValidatedAt.After(time.Now()) {
+		return nil, fmt.Errorf("缓存的验证时间 %s 晚于当前时间", cache.ValidatedAt.Format("2006-01-02 15:04:05"))
+	}
+	return &cache, nil
+}
 
-	authReq := AuthRequest{Key: key}
-	jsonData, err := json.Marshal(authReq)
+// 写入授权缓存
+func writeAuthCache(key string) error {
+	data, err := json.Marshal(AuthCache{KeyHash: hashAuthKey(key), ValidatedAt: time.Now()})
 	if err != nil {
-		return fmt.Errorf("序列化请求失败: %v", err)
+		return err
 	}
 
-	// 创建HTTP客户端，跳过证书验证（本地测试用）
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	// 通过 XZIP_KEY 提供key时 ~/.xzip 可能还不存在
+	cachePath := getAuthCachePath()
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cachePath, data, 0600); err != nil {
+		return err
 	}
-	client := &http.Client{Transport: tr}
+	// 文件已存在时 WriteFile 不会修改权限
+	return os.Chmod(cachePath, 0600)
+}
 
+// 发送一次授权请求，第二个返回值表示失败是否可以重试
+func requestAuth(client *http.Client, jsonData []byte) (*AuthResponse, bool, error) {
 	resp, err := client.Post(AuthURL, "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("网络请求失败: %v", err)
+		return nil, true, fmt.Errorf("网络请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("📡 HTTP状态码: %d\n", resp.StatusCode)
+	logf(logDebug, "HTTP状态码: %d", resp.StatusCode)
 
-	// 验证服务器证书域名（本地测试版本）
-	if err := verifyServerCertificate(resp); err != nil {
-		return err
+	if resp.StatusCode >= 500 {
+		return nil, true, fmt.Errorf("服务器错误: HTTP %d", resp.StatusCode)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("读取响应失败: %v", err)
+		return nil, true, fmt.Errorf("读取响应失败: %v", err)
 	}
 
-	fmt.Printf("📄 服务器响应: %s\n", string(body))
+	logf(logDebug, "服务器响应: %s", strings.TrimSpace(string(body)))
 
 	if len(body) == 0 {
-		return fmt.Errorf("服务器返回空响应")
+		return nil, false, fmt.Errorf("服务器返回空响应")
 	}
 
 	var authResp AuthResponse
 	if err := json.Unmarshal(body, &authResp); err != nil {
-		return fmt.Errorf("解析响应失败: %v, 响应内容: %s", err, string(body))
+		return nil, false, fmt.Errorf("解析响应失败: %v, 响应内容: %s", err, string(body))
+	}
+	return &authResp, false, nil
+}
+
+// 授权请求使用的 HTTP 客户端
+// 使用默认传输层：校验证书链，并按 AuthURL 的域名校验证书；代理按 HTTPS_PROXY、NO_PROXY 等环境变量设置，
+// 指定了 --proxy 时改用指定的代理
+func authClient(timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if authProxy != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(authProxy)
+		client.Transport = transport
+	}
+	return client
+}
+
+// 验证授权
+// forceAuth 为 true 时忽略本地缓存，强制联网验证；timeout 为单次请求的超时时间
+func validateAuth(forceAuth bool, timeout time.Duration) error {
+	key, err := readAuthKey()
+	if err != nil {
+		return fmt.Errorf("授权验证失败: %v", err)
+	}
+
+	cache, _ := readAuthCache(key)
+	if !forceAuth && cache != nil && time.Since(cache.ValidatedAt) < authCacheTTL() {
+		say("✅ 授权验证成功 (本地缓存，验证于 %s)\n", cache.ValidatedAt.Format("2006-01-02 15:04:05"))
+		return nil
+	}
+
+	authReq := AuthRequest{Key: key}
+	jsonData, err := json.Marshal(authReq)
+	if err != nil {
+		return fmt.Errorf("序列化请求失败: %v", err)
+	}
+
+	client := authClient(timeout)
+
+	// 网络错误和 5xx 按指数退避重试，授权被拒等其他结果立即返回
+	var authResp *AuthResponse
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		var retryable bool
+		logf(logDebug, "第 %d 次授权请求: POST %s", attempt, AuthURL)
+		authResp, retryable, err = requestAuth(client, jsonData)
+		if err == nil {
+			break
+		}
+		if !retryable {
+			return err
+		}
+		if attempt >= AuthMaxAttempts {
+			// 连不上服务器（网络错误、超时、5xx）时，宽限期内的缓存仍然有效；被服务器拒绝时缓存已删除，不会走到这里
+			if cache != nil && time.Since(cache.ValidatedAt) < authOfflineGrace() {
+				logf(logWarn, "无法连接授权服务器 (%v)，离线使用: 上次联网验证于 %s，请在 %s 前恢复网络连接",
+					err, cache.ValidatedAt.Format("2006-01-02 15:04:05"),
+					cache.ValidatedAt.Add(authOfflineGrace()).Format("2006-01-02 15:04:05"))
+				return nil
+			}
+			return fmt.Errorf("授权请求失败 (已尝试 %d 次): %v", attempt, err)
+		}
+
+		logf(logWarn, "第 %d 次授权请求失败: %v，%v 后重试", attempt, err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 
+	// 服务器的说明原样显示给用户，去掉控制字符以免干扰终端
+	message := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, authResp.Message))
+
 	if authResp.Status == -1 {
+		os.Remove(getAuthCachePath())
+		if message != "" {
+			return fmt.Errorf("授权失败: %s", message)
+		}
 		return fmt.Errorf("授权失败: 请到 https://xzip.com 购买正版key来正常使用软件")
 	} else if authResp.Status != 1 {
+		if message != "" {
+			return fmt.Errorf("授权状态异常: 状态码 %d (%s)", authResp.Status, message)
+		}
 		return fmt.Errorf("授权状态异常: 状态码 %d", authResp.Status)
 	}
 
-	fmt.Println("✅ 授权验证成功")
+	if err := writeAuthCache(key); err != nil {
+		logf(logWarn, "写入授权缓存失败: %v", err)
+	}
+
+	say("✅ 授权验证成功\n")
 	return nil
 }
 
-// 压缩文件夹到ZIP
-func compressToZip(source, target string) error {
-	fmt.Printf("正在压缩 %s 到 %s\n", source, target)
-	
-	zipFile, err := os.Create(target)
+// list --json 输出的单个条目
+type listEntry struct {
+	Name           string `json:"name"`
+	Size           uint64 `json:"size"`
+	CompressedSize uint64 `json:"compressedSize"`
+	Modified       string `json:"modified"`
+	Method         string `json:"method"`
+	CRC32          string `json:"crc32"`
+	Encrypted      bool   `json:"encrypted"`
+}
+
+// 列出ZIP内容（不解压）
+func listZip(source string, long bool) error {
+	reader, err := client.OpenZip(source)
 	if err != nil {
 		return err
 	}
-	defer zipFile.Close()
-
-	archive := zip.NewWriter(zipFile)
-	defer archive.Close()
-
-	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	defer reader.Close()
 
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
+	// --json 模式下输出条目数组，不区分 --long
+	if jsonOutput {
+		entries := make([]listEntry, 0, len(reader.File))
+		for _, file := range reader.File {
+			entries = append(entries, listEntry{
+				Name:           file.Name,
+				Size:           file.UncompressedSize64,
+				CompressedSize: file.CompressedSize64,
+				Modified:       file.Modified.Format(time.RFC3339),
+				Method:         methodName(file.Method),
+				CRC32:          fmt.Sprintf("%08x", file.CRC32),
+				Encrypted:      file.Flags&0x1 != 0,
+			})
 		}
+		printJSON(entries)
+		return nil
+	}
 
-		relPath, _ := filepath.Rel(source, path)
-		header.Name = relPath
+	if long {
+		fmt.Printf("%12s %12s  %-19s  %-4s  %-8s  %-7s  %s\n", "大小", "压缩后", "修改时间", "加密", "CRC32", "方法", "名称")
+	} else {
+		fmt.Printf("%12s %12s  %-19s  %-4s  %s\n", "大小", "压缩后", "修改时间", "加密", "名称")
+	}
 
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
+	for _, file := range reader.File {
+		// 中央目录中的元数据不加密，加密条目同样可以列出
+		encrypted := "否"
+		if file.Flags&0x1 != 0 {
+			encrypted = "是"
 		}
+		modified := file.Modified.Format("2006-01-02 15:04:05")
 
-		writer, err := archive.CreateHeader(header)
-		if err != nil {
-			return err
+		if long {
+			fmt.Printf("%12d %12d  %-19s  %-4s  %08x  %-7s  %s\n",
+				file.UncompressedSize64, file.CompressedSize64, modified, encrypted,
+				file.CRC32, methodName(file.Method), file.Name)
+		} else {
+			fmt.Printf("%12d %12d  %-19s  %-4s  %s\n",
+				file.UncompressedSize64, file.CompressedSize64, modified, encrypted, file.Name)
 		}
-
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-			_, err = io.Copy(writer, file)
-			return err
+		if file.Comment != "" {
+			fmt.Printf("%12s  注释: %s\n", "", indentLines(file.Comment, strings.Repeat(" ", 20)))
 		}
+	}
 
-		return nil
-	})
+	fmt.Printf("共 %d 个条目\n", len(reader.File))
+	if reader.Comment != "" {
+		fmt.Printf("归档注释: %s\n", indentLines(reader.Comment, strings.Repeat(" ", 10)))
+	}
+	return nil
 }
 
-// 从ZIP解压缩
-func extractFromZip(source, target string) error {
-	fmt.Printf("正在解压缩 %s 到 %s\n", source, target)
-	
-	reader, err := zip.OpenReader(source)
+// 输出归档中名为 name 的条目的详细信息，找不到时在错误中列出名称相近的条目
+func statZip(source, name string) error {
+	reader, err := client.OpenZip(source)
 	if err != nil {
 		return err
 	}
 	defer reader.Close()
 
-	os.MkdirAll(target, 0755)
+	file, err := findEntry(reader.File, name)
+	if err != nil {
+		return err
+	}
 
-	for _, file := range reader.File {
-		path := filepath.Join(target, file.Name)
-		
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.FileInfo().Mode())
-			continue
-		}
+	encrypted := file.Flags&0x1 != 0
+	if jsonOutput {
+		printJSON(map[string]interface{}{
+			"operation":       "stat",
+			"name":            file.Name,
+			"size":            file.UncompressedSize64,
+			"compressed_size": file.CompressedSize64,
+			"crc32":           fmt.Sprintf("%08x", file.CRC32),
+			"method":          methodName(file.Method),
+			"modified":        file.Modified.Format(time.RFC3339),
+			"encrypted":       encrypted,
+			"comment":         file.Comment,
+		})
+		return nil
+	}
 
-		fileReader, err := file.Open()
-		if err != nil {
-			return err
-		}
-		defer fileReader.Close()
+	encryptedText := "否"
+	if encrypted {
+		encryptedText = "是"
+	}
+	fmt.Printf("名称:     %s\n", file.Name)
+	fmt.Printf("大小:     %d 字节\n", file.UncompressedSize64)
+	fmt.Printf("压缩后:   %d 字节\n", file.CompressedSize64)
+	fmt.Printf("CRC32:    %08x\n", file.CRC32)
+	fmt.Printf("方法:     %s\n", methodName(file.Method))
+	fmt.Printf("修改时间: %s\n", file.Modified.Format("2006-01-02 15:04:05"))
+	fmt.Printf("加密:     %s\n", encryptedText)
+	if file.Comment != "" {
+		fmt.Printf("注释:     %s\n", indentLines(file.Comment, strings.Repeat(" ", 10)))
+	}
+	return nil
+}
 
-		os.MkdirAll(filepath.Dir(path), 0755)
-		
-		targetFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.FileInfo().Mode())
-		if err != nil {
-			return err
+// 查找名为 name 的条目，找不到时在错误中列出名称相近的条目
+func findEntry(files []*zip.File, name string) (*zip.File, error) {
+	for _, file := range files {
+		// 目录条目以 / 结尾，允许省略
+		if file.Name == name || file.Name == name+"/" {
+			return file, nil
 		}
-		defer targetFile.Close()
+	}
+	if similar := similarEntries(files, name); len(similar) > 0 {
+		return nil, fmt.Errorf("归档中没有条目 %s，是否要找: %s", name, strings.Join(similar, ", "))
+	}
+	return nil, fmt.Errorf("归档中没有条目 %s", name)
+}
 
-		_, err = io.Copy(targetFile, fileReader)
-		if err != nil {
-			return err
+// 将归档中名为 name 的文件条目的内容写入 w，不创建任何文件
+func catZip(source, name string, w io.Writer) error {
+	reader, err := client.OpenZip(source)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := findEntry(reader.File, name)
+	if err != nil {
+		return err
+	}
+	if file.Mode().IsDir() {
+		return fmt.Errorf("%s 是目录", file.Name)
+	}
+	if !file.Mode().IsRegular() {
+		return fmt.Errorf("%s 不是普通文件", file.Name)
+	}
+
+	fileReader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+	_, err = io.Copy(w, fileReader)
+	return err
+}
+
+// 找出与 name 相近的条目名：忽略大小写相同、文件名相同或包含 name，最多 5 个
+func similarEntries(files []*zip.File, name string) []string {
+	const maxSimilar = 5
+	lower := strings.ToLower(strings.TrimSuffix(name, "/"))
+	base := path.Base(lower)
+
+	var similar []string
+	for _, file := range files {
+		candidate := strings.ToLower(strings.TrimSuffix(file.Name, "/"))
+		if candidate == lower || path.Base(candidate) == base || strings.Contains(candidate, lower) {
+			similar = append(similar, file.Name)
+			if len(similar) == maxSimilar {
+				break
+			}
 		}
 	}
+	return similar
+}
 
-	return nil
+// 多行注释从第二行起缩进 indent，与第一行对齐；去掉末尾的换行
+func indentLines(text, indent string) string {
+	text = strings.TrimRight(text, "\r\n")
+	return strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// 压缩方法名称
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "Store"
+	case zip.Deflate:
+		return "Deflate"
+	case 12:
+		return "Bzip2"
+	case 93:
+		return "Zstd"
+	default:
+		return fmt.Sprintf("%d", method)
+	}
 }
 
-// 初始化key文件
+// 初始化key文件，通过环境变量 XZIP_KEY 提供key时不需要key文件
+// --key-file 指定的文件由用户自行管理，不自动创建
 func initKeyFile() error {
+	if keyFileFlag != "" || strings.TrimSpace(os.Getenv("XZIP_KEY")) != "" {
+		return nil
+	}
+
 	keyPath := getKeyFilePath()
 	keyDir := filepath.Dir(keyPath)
 	
@@ -225,70 +533,1421 @@ func initKeyFile() error {
 		}
 		file.Close()
 		
-		fmt.Printf("已创建key文件: %s\n", keyPath)
-		fmt.Println("请将您的授权key写入此文件")
+		say("已创建key文件: %s\n", keyPath)
+		say("请运行 xzip auth set <key> 配置授权key\n")
 		return fmt.Errorf("key文件为空，请先配置授权key")
 	}
 	
 	return nil
 }
 
-func main() {
-	fmt.Println("XZip 商业压缩软件 v1.0 (本地测试版)")
-	fmt.Println("=================================")
+// 保存授权key到key文件，权限为 0600
+func setAuthKey(key string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("key不能为空")
+	}
 
-	if err := initKeyFile(); err != nil {
-		fmt.Printf("❌ 初始化失败: %v\n", err)
-		return
+	keyPath := getKeyFilePath()
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := ioutil.WriteFile(keyPath, []byte(key+"\n"), 0600); err != nil {
+		return fmt.Errorf("写入key文件失败: %v", err)
+	}
+	// 文件已存在时 WriteFile 不会修改权限
+	if err := os.Chmod(keyPath, 0600); err != nil {
+		return err
 	}
 
-	if err := validateAuth(); err != nil {
-		fmt.Printf("❌ %v\n", err)
-		return
+	// 旧key的缓存已经没有意义
+	os.Remove(getAuthCachePath())
+	return nil
+}
+
+// 删除key文件和授权缓存
+func clearAuthKey() error {
+	if err := os.Remove(getKeyFilePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除key文件失败: %v", err)
+	}
+	if err := os.Remove(getAuthCachePath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除授权缓存失败: %v", err)
 	}
+	return nil
+}
 
-	if len(os.Args) < 2 {
-		fmt.Println("使用方法:")
-		fmt.Println("  压缩: xzip compress <源文件/文件夹> <目标.zip文件>")
-		fmt.Println("  解压: xzip extract <源.zip文件> <目标文件夹>")
-		return
+// 处理 auth 子命令：set 保存key，check 联网验证key，clear 删除key
+func runAuthCommand(args []string, timeout time.Duration) {
+	if len(args) < 1 {
+		reportError(ExitUsage, "参数不足: xzip auth <set <key>|check|clear>")
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) != 2 {
+			reportError(ExitUsage, "参数不足: xzip auth set <key>")
+		}
+		if err := setAuthKey(args[1]); err != nil {
+			reportError(ExitIO, "%v", err)
+		}
+		if jsonOutput {
+			printJSON(map[string]interface{}{"operation": "auth set", "path": getKeyFilePath()})
+		} else {
+			say("✅ 已保存授权key到 %s\n", getKeyFilePath())
+		}
+		if os.Getenv("XZIP_KEY") != "" && keyFileFlag == "" {
+			logf(logWarn, "已设置环境变量 XZIP_KEY，将优先使用环境变量中的key")
+		}
+	case "check":
+		// 检查总是联网验证，不使用本地缓存
+		if err := validateAuth(true, timeout); err != nil {
+			reportError(ExitAuth, "%v", err)
+		}
+		if jsonOutput {
+			printJSON(map[string]interface{}{"operation": "auth check", "valid": true})
+		}
+	case "clear":
+		if err := clearAuthKey(); err != nil {
+			reportError(ExitIO, "%v", err)
+		}
+		if jsonOutput {
+			printJSON(map[string]interface{}{"operation": "auth clear", "path": getKeyFilePath()})
+		} else {
+			say("✅ 已删除授权key %s\n", getKeyFilePath())
+		}
+	default:
+		reportError(ExitUsage, "未知的 auth 子命令: %s，支持: set, check, clear", args[0])
 	}
+}
 
-	command := os.Args[1]
+// 可重复指定的字符串选项，如 --exclude a --exclude b
+type stringList []string
 
-	switch command {
-	case "compress":
-		if len(os.Args) < 4 {
-			fmt.Println("❌ 参数不足: xzip compress <源文件/文件夹> <目标.zip文件>")
-			return
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// 创建子命令的选项集，解析错误和帮助均由 parseFlags 输出
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	return fs
+}
+
+// 输出子命令的用法和各选项的说明
+func printUsage(fs *flag.FlagSet, usage string) {
+	out := messageOut()
+	fmt.Fprintf(out, "用法: %s\n", usage)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(out, "选项:")
+		fs.SetOutput(out)
+		fs.PrintDefaults()
+	}
+}
+
+// 解析子命令参数，返回位置参数
+// flag 包遇到第一个位置参数就停止解析，这里逐个取出位置参数后继续解析，使选项可以出现在任意位置；
+// -- 之后的参数全部视为位置参数。-h/--help 时输出用法并退出
+func parseFlags(fs *flag.FlagSet, usage string, args []string) []string {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if err == flag.ErrHelp {
+			printUsage(fs, usage)
+			os.Exit(0)
+		}
+		if err != nil {
+			reportError(ExitUsage, "参数错误: %v", err)
 		}
 
-		source := os.Args[2]
-		target := os.Args[3]
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...)
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
 
-		if err := compressToZip(source, target); err != nil {
-			fmt.Printf("❌ 压缩失败: %v\n", err)
-		} else {
-			fmt.Printf("✅ 压缩完成: %s\n", target)
+// 从参数中取出全局开关选项（可出现在任意位置），返回剩余参数
+func takeFlag(args []string, name string) ([]string, bool) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, arg := range args {
+		if arg == name {
+			found = true
+			continue
 		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
 
-	case "extract":
-		if len(os.Args) < 4 {
-			fmt.Println("❌ 参数不足: xzip extract <源.zip文件> <目标文件夹>")
-			return
+// 从参数中取出带值的全局选项（支持 --name value 和 --name=value），返回剩余参数
+func takeOption(args []string, name string) ([]string, string, bool, error) {
+	rest := make([]string, 0, len(args))
+	value := ""
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == name {
+			if i+1 >= len(args) {
+				return nil, "", false, fmt.Errorf("选项 %s 缺少参数值", name)
+			}
+			i++
+			value, found = args[i], true
+			continue
+		}
+		if strings.HasPrefix(arg, name+"=") {
+			value, found = strings.TrimPrefix(arg, name+"="), true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, value, found, nil
+}
+
+// 解析时长，支持 10s、1m 等格式，纯数字按秒计
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// 解析 --since：RFC3339 时间，或表示多久之前的时长（如 24h、90m）
+func parseSince(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("无效的 --since: %s，应为 RFC3339 时间（如 2024-05-01T00:00:00+08:00）或时长（如 24h）", value)
+}
+
+// 解析压缩级别，支持 0-9 或 store（0 与 store 均表示仅存储）
+func parseLevel(value string) (int, error) {
+	if value == "store" {
+		return archive.LevelStore, nil
+	}
+	level, err := strconv.Atoi(value)
+	if err != nil || level < 0 || level > 9 {
+		return 0, fmt.Errorf("无效的压缩级别: %s (应为 0-9 或 store)", value)
+	}
+	if level == 0 {
+		return archive.LevelStore, nil
+	}
+	return level, nil
+}
+
+// 解析字节数，支持 K、M、G 后缀（按 1024 进位，后缀后可带 B 或 iB，如 256K、1MiB），纯数字按字节计
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+// 解析 --buffer-size 选项，未指定时返回 0（使用默认大小）
+func parseBufferSize(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	size, err := parseSize(value)
+	if err != nil || size <= 0 || size > 1<<30 {
+		return 0, fmt.Errorf("无效的缓冲区大小: %s", value)
+	}
+	return int(size), nil
+}
+
+// 解析 --limit-rate 选项（每秒字节数，支持 K、M、G 后缀），未指定时返回 0（不限速）
+func parseRateLimit(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	rate, err := parseSize(value)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("无效的速率限制: %s", value)
+	}
+	return rate, nil
+}
+
+// --progress 使用的进度回调：百分比变化时在 out 的同一行刷新，完成时换行
+func progressPrinter(out io.Writer) func(entry string, bytesDone, bytesTotal int64) {
+	last := -1
+	return func(entry string, bytesDone, bytesTotal int64) {
+		percent := 100
+		if bytesTotal > 0 {
+			percent = int(bytesDone * 100 / bytesTotal)
 		}
+		if percent != last {
+			last = percent
+			fmt.Fprintf(out, "\r进度: %3d%%", percent)
+		}
+		if entry == "" && bytesDone == bytesTotal {
+			fmt.Fprintln(out)
+		}
+	}
+}
 
-		source := os.Args[2]
-		target := os.Args[3]
+// 格式化字节数，如 1.5 KiB、128.0 MiB
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
 
-		if err := extractFromZip(source, target); err != nil {
-			fmt.Printf("❌ 解压缩失败: %v\n", err)
+// 压缩结果摘要，如 "42 个文件，128.0 MiB → 37.0 MiB (节省 71%)"
+func compressionSummary(result *archive.Result) string {
+	summary := fmt.Sprintf("%d 个文件，%s → %s", result.Files, formatSize(result.Bytes), formatSize(result.ArchiveBytes))
+	if result.Bytes > 0 {
+		saved := 100 - result.ArchiveBytes*100/result.Bytes
+		if saved >= 0 {
+			summary += fmt.Sprintf(" (节省 %d%%)", saved)
 		} else {
-			fmt.Printf("✅ 解压缩完成: %s\n", target)
+			summary += fmt.Sprintf(" (增大 %d%%)", -saved)
 		}
+	}
+	return summary
+}
 
-	default:
-		fmt.Printf("❌ 未知命令: %s\n", command)
-		fmt.Println("支持的命令: compress, extract")
+// 提示压缩时跳过的特殊文件和出错的文件
+func warnSkipped(result *archive.Result) {
+	for _, name := range result.Skipped {
+		logf(logWarn, "已跳过特殊文件: %s", name)
+	}
+	for _, err := range result.Errors {
+		logf(logWarn, "已跳过出错的文件: %v", err)
+	}
+}
+
+// --keep-going 跳过了出错的文件时，归档虽已生成，仍以非零状态退出
+func exitIfErrors(result *archive.Result) {
+	if len(result.Errors) == 0 {
+		return
+	}
+	if jsonOutput {
+		os.Exit(ExitIO)
+	}
+	reportError(ExitIO, "%d 个文件因出错被跳过", len(result.Errors))
+}
+
+// 将错误转换为字符串，用于 JSON 输出
+func errorStrings(errs []error) []string {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return messages
+}
+
+// 返回收到 Ctrl-C（SIGINT）或 SIGTERM 时取消的 context，压缩、解压据此中止并清理未完成的输出
+// 清理期间再次收到信号时立即退出，以免卡在等待输入等无法中止的地方
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logf(logWarn, "正在中断，清理未完成的输出（再按一次 Ctrl-C 立即退出）")
+		cancel()
+		<-signals
+		os.Exit(ExitInterrupted)
+	}()
+	return ctx
+}
+
+// 操作因 ctx 被取消而失败时报告中断并以 ExitInterrupted 退出
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		reportError(ExitInterrupted, "操作已中断，未完成的输出已清理")
+	}
+}
+
+// 输出提示并读取用户的回答，回答 y 或 yes 时返回 true
+func confirm(format string, a ...interface{}) bool {
+	// 提示必须显示，--quiet 模式下也输出
+	fmt.Fprintf(messageOut(), format, a...)
+	answer, _ := stdinReader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// 交互式确认是否覆盖已存在的文件
+func confirmOverwrite(path string) bool {
+	return confirm("⚠️  文件已存在: %s，是否覆盖? [y/N] ", path)
+}
+
+// 目标文件夹不为空时交互式确认是否继续解压，文件夹不存在或为空时直接返回 true
+// 只统计第一层的文件和文件夹，很大的目录也能很快完成
+func confirmNonEmptyTarget(target string) bool {
+	dir, err := os.Open(target)
+	if err != nil {
+		// 不存在时由解压创建，其他错误留给解压报告
+		return true
+	}
+	names, _ := dir.Readdirnames(-1)
+	dir.Close()
+	if len(names) == 0 {
+		return true
+	}
+	return confirm("⚠️  目标文件夹 %s 不为空（已有 %d 个文件或文件夹），是否继续解压? [y/N] ", target, len(names))
+}
+
+// 版本信息，发布构建时通过 -ldflags 注入，如
+// go build -ldflags "-X main.version=1.1 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "1.0"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// 开发构建（xzip_dev.go）中为 true，此时设置环境变量 XZIP_SKIP_AUTH=1 可以跳过授权验证，
+// 便于在没有网络和key的环境中测试压缩解压。bool 变量无法通过 -ldflags -X 修改
+var devBuild bool
+
+// 输出版本信息
+func printVersion() {
+	if jsonOutput {
+		printJSON(map[string]string{
+			"version":    version,
+			"commit":     commit,
+			"build_date": buildDate,
+			"go":         runtime.Version(),
+		})
+		return
+	}
+	fmt.Printf("xzip %s (commit %s，构建于 %s，%s %s/%s)\n", version, commit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+var (
+	// 标准输入，交互式提示共用
+	stdinReader = bufio.NewReader(os.Stdin)
+
+	// --json 模式下 stdout 只输出 JSON 结果，提示信息改写到 stderr
+	jsonOutput bool
+	// 压缩到标准输出时 stdout 用于输出 ZIP 数据，提示信息改写到 stderr
+	stdoutData bool
+	// --quiet 模式下不输出提示信息，错误输出到 stderr
+	quiet bool
+	// 日志级别，默认输出警告和错误；--quiet 时只输出错误
+	logLevel = logWarn
+	// --key-file 指定的key文件路径，为空时使用默认路径
+	keyFileFlag string
+	// --proxy 指定的授权请求代理，为 nil 时按环境变量使用代理
+	authProxy *url.URL
+	// --temp-dir 指定的临时文件夹，为空时使用默认位置
+	tempDir string
+	// 授权验证通过后的会话，各命令通过它压缩和解压
+	client *archive.Client
+)
+
+// 提示信息的输出位置
+func messageOut() io.Writer {
+	if jsonOutput || stdoutData {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// 输出提示信息，--quiet 模式下不输出
+func say(format string, a ...interface{}) {
+	if quiet {
+		return
+	}
+	fmt.Fprintf(messageOut(), format, a...)
+}
+
+// 输出 JSON 结果
+func printJSON(v interface{}) {
+	json.NewEncoder(os.Stdout).Encode(v)
+}
+
+// 输出错误并以退出码 code 退出，--json 模式下输出 {"error": "..."}
+func reportError(code int, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	if jsonOutput {
+		printJSON(map[string]string{"error": message})
+	} else {
+		logf(logError, "%s", message)
+	}
+	os.Exit(code)
+}
+
+// 日志级别，由 --log-level 指定
+const (
+	logDebug = iota
+	logInfo
+	logWarn
+	logError
+)
+
+var logLevelNames = map[string]int{"debug": logDebug, "info": logInfo, "warn": logWarn, "error": logError}
+
+// 各级别日志的前缀
+var logPrefixes = [...]string{logDebug: "[调试] ", logInfo: "[信息] ", logWarn: "⚠️  ", logError: "❌ "}
+
+// 输出一行日志到 stderr，低于 --log-level 的不输出
+// 命令的正常输出仍用 say，日志用于警告、错误和诊断信息
+func logf(level int, format string, a ...interface{}) {
+	if level < logLevel {
+		return
+	}
+	fmt.Fprintf(os.Stderr, logPrefixes[level]+format+"\n", a...)
+}
+
+// 按行写入日志的 Writer，用于把归档库的逐条目输出作为调试日志
+type logWriter int
+
+func (w logWriter) Write(b []byte) (int, error) {
+	if int(w) >= logLevel {
+		fmt.Fprint(os.Stderr, logPrefixes[w]+strings.TrimLeft(string(b), " "))
+	}
+	return len(b), nil
+}
+
+// 归档库逐条目输出的去向：-v 时输出到提示信息，调试级别日志时作为日志输出，否则不输出
+func verboseOut(verbose bool) io.Writer {
+	if verbose {
+		return messageOut()
+	}
+	if logLevel <= logDebug {
+		return logWriter(logDebug)
+	}
+	return nil
+}
+
+func main() {
+	cliArgs, forceAuth := takeFlag(os.Args[1:], "--force-auth")
+	cliArgs, jsonOutput = takeFlag(cliArgs, "--json")
+	cliArgs, quiet = takeFlag(cliArgs, "--quiet")
+	if rest, ok := takeFlag(cliArgs, "-q"); ok {
+		cliArgs, quiet = rest, true
+	}
+
+	// 目标为 - 时压缩到标准输出；--files-from - 等选项的值不算
+	if len(cliArgs) > 0 && cliArgs[0] == "compress" {
+		stdoutData = compressToStdout(cliArgs[1:])
+	}
+
+	// cat 将条目内容输出到标准输出
+	if len(cliArgs) > 0 && cliArgs[0] == "cat" {
+		stdoutData = true
+	}
+
+	// version 只输出版本信息，不需要授权，也不输出标题
+	if len(cliArgs) > 0 && cliArgs[0] == "version" {
+		printVersion()
+		return
+	}
+
+	say("XZip 商业压缩软件 v%s\n", version)
+	say("=================================\n")
+
+	cliArgs, timeoutValue, ok, err := takeOption(cliArgs, "--auth-timeout")
+	if err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	cliArgs, keyFileFlag, _, err = takeOption(cliArgs, "--key-file")
+	if err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	cliArgs, proxyValue, hasProxy, err := takeOption(cliArgs, "--proxy")
+	if err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if hasProxy {
+		authProxy, err = url.Parse(proxyValue)
+		if err != nil || authProxy.Host == "" {
+			reportError(ExitUsage, "无效的代理地址: %s，应为 http://host:port 的形式", proxyValue)
+		}
+	}
+	cliArgs, tempDir, _, err = takeOption(cliArgs, "--temp-dir")
+	if err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if tempDir != "" {
+		if info, err := os.Stat(tempDir); err != nil || !info.IsDir() {
+			reportError(ExitUsage, "临时文件夹不存在: %s", tempDir)
+		}
+	}
+	cliArgs, levelName, hasLevel, err := takeOption(cliArgs, "--log-level")
+	if err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if hasLevel {
+		level, known := logLevelNames[levelName]
+		if !known {
+			reportError(ExitUsage, "无效的日志级别: %s，支持: debug, info, warn, error", levelName)
+		}
+		logLevel = level
+	} else if quiet {
+		logLevel = logError
+	}
+	authTimeout := DefaultAuthTimeout
+	if ok {
+		authTimeout, err = parseDuration(timeoutValue)
+		if err != nil || authTimeout <= 0 {
+			reportError(ExitUsage, "无效的超时时间: %s", timeoutValue)
+		}
+	}
+
+	// auth 子命令用于配置key，必须在授权验证之前处理
+	if len(cliArgs) > 0 && cliArgs[0] == "auth" {
+		runAuthCommand(cliArgs[1:], authTimeout)
+		return
+	}
+
+	var authorize archive.Authorizer
+	if devBuild && os.Getenv("XZIP_SKIP_AUTH") == "1" {
+		logf(logWarn, "开发构建: 已按 XZIP_SKIP_AUTH 跳过授权验证")
+	} else {
+		if err := initKeyFile(); err != nil {
+			reportError(ExitAuth, "初始化失败: %v", err)
+		}
+		authorize = func() error {
+			return validateAuth(forceAuth, authTimeout)
+		}
+	}
+	if client, err = archive.NewClient(authorize); err != nil {
+		reportError(ExitAuth, "%v", err)
+	}
+
+	if len(cliArgs) < 1 {
+		say("使用方法:\n")
+		say("  压缩: %s\n", compressUsage)
+		say("  解压: %s\n", extractUsage)
+		say("  追加: %s\n", addUsage)
+		say("  列表: %s\n", listUsage)
+		say("  校验: %s\n", testUsage)
+		say("  条目信息: %s\n", statUsage)
+		say("  输出条目: %s\n", catUsage)
+		say("  版本: xzip version\n")
+		say("  授权: xzip auth <set <key>|check|clear>\n")
+		say("使用 xzip <命令> -h 查看命令的选项\n")
+		say("授权key读取顺序: --key-file 指定的文件 > 环境变量 XZIP_KEY > ~/%s\n", KeyFile)
+		say("连不上授权服务器时，距上次联网验证成功 %d 天内仍可离线使用（环境变量 XZIP_AUTH_OFFLINE_GRACE 可缩短，如 72h）\n", int(DefaultAuthOfflineGrace.Hours()/24))
+		say("全局选项:\n")
+		say("  --force-auth          忽略本地授权缓存，强制联网验证\n")
+		say("  --auth-timeout <时长>  授权请求超时时间 (默认 10s)\n")
+		say("  --key-file <路径>      使用指定的key文件\n")
+		say("  --proxy <地址>         授权请求使用的代理，如 http://proxy:8080 (默认按 HTTPS_PROXY 环境变量)\n")
+		say("  --temp-dir <路径>      临时文件的位置 (默认: 临时归档在目标归档旁边，缓存标准输入的 ZIP 在 TMPDIR)；\n")
+		say("                        与目标不在同一文件系统时临时归档要先复制过去，大归档较慢\n")
+		say("  --json                以 JSON 格式输出结果\n")
+		say("  -q, --quiet           只输出错误信息（输出到 stderr）\n")
+		say("  --log-level <级别>    stderr 日志级别: debug, info, warn, error (默认 warn)\n")
+		say("退出码:\n")
+		say("  0 成功，%d 参数错误，%d 授权失败，%d 读写或归档错误，%d 校验失败，%d 被中断\n", ExitUsage, ExitAuth, ExitIO, ExitVerify, ExitInterrupted)
+		os.Exit(ExitUsage)
+	}
+
+	command := cliArgs[0]
+
+	switch command {
+	case "compress":
+		runCompress(cliArgs[1:])
+	case "extract":
+		runExtract(cliArgs[1:])
+	case "add":
+		runAdd(cliArgs[1:])
+	case "list":
+		runList(cliArgs[1:])
+	case "test":
+		runTest(cliArgs[1:])
+	case "stat":
+		runStat(cliArgs[1:])
+	case "cat":
+		runCat(cliArgs[1:])
+	default:
+		say("支持的命令: compress, extract, add, list, test, stat, cat, auth, version\n")
+		reportError(ExitUsage, "未知命令: %s", command)
+	}
+}
+
+// 各子命令的用法
+const (
+	compressUsage = "xzip compress <源文件/文件夹>... <目标归档文件|-> [选项]"
+	extractUsage  = "xzip extract <源归档文件|-> <目标文件夹> [条目规则...] [选项]"
+	addUsage      = "xzip add <目标.zip文件> <文件/文件夹>... [选项]"
+	listUsage     = "xzip list <源.zip文件> [选项]"
+	testUsage     = "xzip test <源.zip文件>"
+	statUsage     = "xzip stat <源.zip文件> <条目名>"
+	catUsage      = "xzip cat <源.zip文件> <条目名>"
+)
+
+// 自解压程序的路径：指定了 stub 时直接使用，否则为 xzip 所在目录下 platform 平台的 xzip-sfx-<平台>
+func sfxStubPath(stub, platform string) (string, error) {
+	if stub != "" {
+		return stub, nil
+	}
+	if platform != "linux" && platform != "darwin" && platform != "windows" {
+		return "", fmt.Errorf("不支持的自解压平台: %s，支持: linux, darwin, windows", platform)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	name := "xzip-sfx-" + platform
+	if platform == "windows" {
+		name += ".exe"
+	}
+	path := filepath.Join(filepath.Dir(exe), name)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("找不到 %s 平台的自解压程序 %s，请用 --sfx-stub 指定", platform, path)
+	}
+	return path, nil
+}
+
+// 读取 --files-from 的文件列表：每行一个路径，相对路径相对于 base，忽略空行
+// listPath 为 - 时从标准输入读取
+func readFileList(listPath, base string) ([]string, error) {
+	var data []byte
+	var err error
+	if listPath == "-" {
+		data, err = ioutil.ReadAll(stdinReader)
+	} else {
+		data, err = ioutil.ReadFile(listPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(base, line)
+		}
+		sources = append(sources, line)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s 中没有文件", listPath)
+	}
+	return sources, nil
+}
+
+// 返回路径上包含 target 的源，没有时返回空字符串
+func sourceContaining(sources []string, target string) string {
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return ""
+	}
+	for _, source := range sources {
+		absSource, err := filepath.Abs(source)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absSource, absTarget)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return source
+		}
+	}
+	return ""
+}
+
+// 压缩
+
+// 按 compress 的选项解析参数，判断压缩目标（最后一个位置参数）是否为 -；参数有误时返回 false，由 runCompress 报错
+func compressToStdout(args []string) bool {
+	fs, _ := newCompressFlags()
+	var last string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return false
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return last == "-"
+		}
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return rest[len(rest)-1] == "-"
+		}
+		last = rest[0]
+		args = rest[1:]
+	}
+}
+
+// compress 的选项
+type compressFlags struct {
+	format                   *string
+	method                   *string
+	level                    *string
+	storeExt                 *string
+	ignoreFile               *string
+	comment                  *string
+	commentFile              *string
+	prefix                   *string
+	filesFrom                *string
+	base                     *string
+	splitSize                *string
+	sfx                      *bool
+	sfxTarget                *string
+	sfxStub                  *string
+	jobs                     *int
+	bufferSize               *string
+	limitRate                *string
+	dereference              *bool
+	dedup                    *bool
+	depth                    *int
+	since                    *string
+	reproducible             *bool
+	strict                   *bool
+	keepGoing                *bool
+	dryRun                   *bool
+	showProgress             *bool
+	excludes                 stringList
+	includes                 stringList
+	maxFileSize, minFileSize string
+	verbose                  bool
+}
+
+// 创建 compress 的选项集，main 判断压缩目标时也按它解析参数
+func newCompressFlags() (*flag.FlagSet, *compressFlags) {
+	fs := newFlagSet("compress")
+	f := &compressFlags{}
+	f.format = fs.String("format", archive.FormatZip, "归档格式: zip 或 targz")
+	f.method = fs.String("method", archive.MethodDeflate, "zip 条目的压缩方法: deflate 或 zstd（zstd 为非标准格式）")
+	f.level = fs.String("level", "", "压缩级别 0-9 或 store")
+	f.storeExt = fs.String("store-ext", strings.Join(archive.DefaultStoreExts, ","), "这些扩展名的文件仅存储不压缩（逗号分隔，仅 zip），设为空字符串则全部压缩")
+	fs.Var(&f.excludes, "exclude", "排除匹配规则的文件或目录，可重复指定")
+	fs.Var(&f.includes, "include", "只添加匹配规则的文件或目录（排除规则优先），可重复指定")
+	f.ignoreFile = fs.String("ignore-file", "", "使用指定的忽略规则文件（.gitignore 语法，默认读取源目录下的 .xzipignore）")
+	f.comment = fs.String("comment", "", "写入归档注释，如构建的 git 提交号（仅 zip）")
+	f.commentFile = fs.String("comment-file", "", "从文件读取归档注释，可以有多行，如许可声明（仅 zip）")
+	f.prefix = fs.String("prefix", "", "所有条目放在归档内的此目录下，如 release")
+	f.filesFrom = fs.String("files-from", "", "从文件读取要压缩的文件和文件夹，每行一个，按列表顺序添加（- 表示标准输入）")
+	f.base = fs.String("base", "", "--files-from 中相对路径的基准目录，条目名为相对于它的路径 (默认当前目录)")
+	f.splitSize = fs.String("split-size", "", "写成每卷不超过此大小的分卷归档，如 100M：依次生成 NAME.z01、NAME.z02……，最后一卷为 NAME.zip（仅 zip，不小于 64K）")
+	f.sfx = fs.Bool("sfx", false, "生成自解压文件，接收方无需安装 xzip 即可运行解压（仅 zip）")
+	f.sfxTarget = fs.String("sfx-target", runtime.GOOS, "自解压文件运行的平台: linux、darwin 或 windows")
+	f.sfxStub = fs.String("sfx-stub", "", "使用指定的自解压程序（默认为 xzip 所在目录下的 xzip-sfx-<平台>）")
+	f.jobs = fs.Int("jobs", runtime.NumCPU(), "并行压缩的协程数")
+	f.bufferSize = fs.String("buffer-size", "", "读写缓冲区大小，如 1M (默认 256K)")
+	f.limitRate = fs.String("limit-rate", "", "限制读写文件内容的速率（每秒字节数），如 20M，默认不限速")
+	f.dereference = fs.Bool("dereference", false, "跟随符号链接，压缩链接指向的文件或目录")
+	f.dedup = fs.Bool("dedup", false, "内容相同的文件只存储一份，其余写为引用条目（仅 zip；其他解压工具会解压为指向原文件的符号链接）")
+	f.depth = fs.Int("depth", -1, "只深入源文件夹的前 N+1 层：0 只压缩源文件夹中的直接内容（子文件夹只保留空目录），1 再加上子文件夹中的内容，依此类推；默认不限制")
+	fs.StringVar(&f.maxFileSize, "max-file-size", "", "跳过大于此大小的文件，如 10M")
+	fs.StringVar(&f.maxFileSize, "exclude-larger-than", "", "同 --max-file-size")
+	fs.StringVar(&f.minFileSize, "min-file-size", "", "跳过小于此大小的文件，如 1K")
+	fs.StringVar(&f.minFileSize, "exclude-smaller-than", "", "同 --min-file-size")
+	f.since = fs.String("since", "", "只添加此后修改的文件，用于增量备份：RFC3339 时间（如 2024-05-01T00:00:00+08:00）或时长（如 24h）")
+	f.reproducible = fs.Bool("reproducible", false, "生成可复现的归档（遵循 SOURCE_DATE_EPOCH）")
+	f.strict = fs.Bool("strict", false, "遇到设备文件、套接字等特殊文件时报错")
+	f.keepGoing = fs.Bool("keep-going", false, "跳过无法读取的文件继续压缩")
+	f.dryRun = fs.Bool("dry-run", false, "只列出将要添加的条目，不创建归档")
+	f.showProgress = fs.Bool("progress", false, "在 stderr 输出进度")
+	fs.BoolVar(&f.verbose, "v", false, "输出每个添加的条目")
+	fs.BoolVar(&f.verbose, "verbose", false, "同 -v")
+	return fs, f
+}
+
+func runCompress(cliArgs []string) {
+	fs, f := newCompressFlags()
+	args := parseFlags(fs, compressUsage, cliArgs)
+
+	var sources []string
+	var target string
+	if *f.filesFrom != "" {
+		// 源全部来自列表，位置参数只有目标
+		if len(args) != 1 {
+			reportError(ExitUsage, "使用 --files-from 时只需指定目标归档文件: %s", compressUsage)
+		}
+		target = args[0]
+		list, err := readFileList(*f.filesFrom, *f.base)
+		if err != nil {
+			reportError(ExitUsage, "读取文件列表失败: %v", err)
+		}
+		sources = list
+	} else {
+		if *f.base != "" {
+			reportError(ExitUsage, "--base 只能与 --files-from 一起使用")
+		}
+		if len(args) < 2 {
+			reportError(ExitUsage, "参数不足: %s", compressUsage)
+		}
+		// 最后一个位置参数为目标，其余均为源
+		sources = args[:len(args)-1]
+		target = args[len(args)-1]
+	}
+
+	options := archive.Options{
+		Format:      *f.format,
+		Method:      *f.method,
+		Excludes:    f.excludes,
+		Includes:    f.includes,
+		IgnoreFile:  *f.ignoreFile,
+		Prefix:      *f.prefix,
+		Comment:     *f.comment,
+		Dereference: *f.dereference,
+		Dedup:       *f.dedup,
+		Jobs:        *f.jobs,
+		Strict:      *f.strict,
+		KeepGoing:   *f.keepGoing,
+		DryRun:      *f.dryRun,
+	}
+	if options.Format != archive.FormatZip && options.Format != archive.FormatTarGz {
+		reportError(ExitUsage, "不支持的格式: %s，支持: zip, targz", options.Format)
+	}
+	// 命令行上的深度从 0 开始计，Options.MaxDepth 以源中的直接内容为第 1 层，0 表示不限制
+	if *f.depth < -1 {
+		reportError(ExitUsage, "无效的 --depth: %d", *f.depth)
+	}
+	options.MaxDepth = *f.depth + 1
+	if f.maxFileSize != "" {
+		size, err := parseSize(f.maxFileSize)
+		if err != nil {
+			reportError(ExitUsage, "无效的 --max-file-size: %s", f.maxFileSize)
+		}
+		options.MaxFileSize = size
+	}
+	if f.minFileSize != "" {
+		size, err := parseSize(f.minFileSize)
+		if err != nil {
+			reportError(ExitUsage, "无效的 --min-file-size: %s", f.minFileSize)
+		}
+		options.MinFileSize = size
+	}
+	if options.MaxFileSize > 0 && options.MinFileSize > options.MaxFileSize {
+		reportError(ExitUsage, "--min-file-size 不能大于 --max-file-size")
+	}
+	if *f.since != "" {
+		cutoff, err := parseSince(*f.since)
+		if err != nil {
+			reportError(ExitUsage, "%v", err)
+		}
+		options.Since = cutoff
+	}
+	if *f.filesFrom != "" {
+		options.BaseDir = *f.base
+		if options.BaseDir == "" {
+			options.BaseDir = "."
+		}
+	}
+	switch {
+	case options.Method != archive.MethodDeflate && options.Method != archive.MethodZstd:
+		reportError(ExitUsage, "不支持的压缩方法: %s，支持: deflate, zstd", options.Method)
+	case options.Method == archive.MethodZstd && options.Format == archive.FormatTarGz:
+		reportError(ExitUsage, "--method 仅支持 zip 格式")
+	case options.Method == archive.MethodZstd:
+		logf(logWarn, "zstd 压缩的 zip 不是标准格式，只有 xzip 等支持 zstd 的工具能够解压")
+	}
+	if *f.commentFile != "" {
+		if *f.comment != "" {
+			reportError(ExitUsage, "--comment 与 --comment-file 不能同时使用")
+		}
+		data, err := ioutil.ReadFile(*f.commentFile)
+		if err != nil {
+			reportError(ExitUsage, "读取注释文件失败: %v", err)
+		}
+		options.Comment = string(data)
+	}
+	if options.Comment != "" && options.Format == archive.FormatTarGz {
+		reportError(ExitUsage, "--comment 和 --comment-file 仅支持 zip 格式")
+	}
+	if options.Jobs < 1 {
+		reportError(ExitUsage, "无效的并行数: %d", options.Jobs)
+	}
+	for _, ext := range strings.Split(*f.storeExt, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			options.StoreExts = append(options.StoreExts, ext)
+		}
+	}
+	if *f.splitSize != "" {
+		size, err := parseSize(*f.splitSize)
+		if err != nil || size <= 0 {
+			reportError(ExitUsage, "无效的 --split-size: %s", *f.splitSize)
+		}
+		switch {
+		case options.Format == archive.FormatTarGz:
+			reportError(ExitUsage, "--split-size 仅支持 zip 格式")
+		case *f.sfx:
+			reportError(ExitUsage, "--split-size 不能与 --sfx 同时使用")
+		case target == "-":
+			reportError(ExitUsage, "--split-size 不能与压缩到标准输出同时使用")
+		}
+		options.SplitSize = size
+	}
+	if *f.sfx {
+		if options.Format == archive.FormatTarGz {
+			reportError(ExitUsage, "--sfx 仅支持 zip 格式")
+		}
+		stub, err := sfxStubPath(*f.sfxStub, *f.sfxTarget)
+		if err != nil {
+			reportError(ExitUsage, "%v", err)
+		}
+		options.SFXStub = stub
+	}
+	if *f.showProgress {
+		options.OnProgress = progressPrinter(os.Stderr)
+	}
+	options.Verbose = verboseOut(f.verbose || *f.dryRun)
+	if *f.reproducible {
+		options.Reproducible = true
+		// 遵循 SOURCE_DATE_EPOCH 约定（https://reproducible-builds.org/specs/source-date-epoch/）
+		if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+			seconds, err := strconv.ParseInt(epoch, 10, 64)
+			if err != nil {
+				reportError(ExitUsage, "无效的 SOURCE_DATE_EPOCH: %s", epoch)
+			}
+			options.ModTime = time.Unix(seconds, 0).UTC()
+		}
+	}
+	var err error
+	if *f.level != "" {
+		if options.Level, err = parseLevel(*f.level); err != nil {
+			reportError(ExitUsage, "%v", err)
+		}
+	}
+	if options.BufferSize, err = parseBufferSize(*f.bufferSize); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if options.RateLimit, err = parseRateLimit(*f.limitRate); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	options.TempDir = tempDir
+
+	ctx := interruptContext()
+	options.Context = ctx
+
+	var result *archive.Result
+	if target == "-" {
+		if jsonOutput {
+			reportError(ExitUsage, "--json 不能与压缩到标准输出同时使用")
+		}
+		say("正在压缩 %s 到标准输出\n", strings.Join(sources, ", "))
+		result, err = client.CompressTo(sources, os.Stdout, options)
+	} else {
+		lower := strings.ToLower(target)
+		if options.Format == archive.FormatTarGz {
+			if !strings.HasSuffix(lower, ".tar.gz") && !strings.HasSuffix(lower, ".tgz") {
+				logf(logWarn, "目标文件 %s 没有 .tar.gz 扩展名", target)
+			}
+		} else if *f.sfx {
+			if *f.sfxTarget == "windows" && filepath.Ext(lower) != ".exe" {
+				logf(logWarn, "目标文件 %s 没有 .exe 扩展名，在 Windows 上无法直接运行", target)
+			}
+		} else if filepath.Ext(lower) != ".zip" {
+			logf(logWarn, "目标文件 %s 没有 .zip 扩展名", target)
+		}
+		if source := sourceContaining(sources, target); source != "" {
+			logf(logWarn, "目标 %s 位于源 %s 之内，压缩时将跳过归档自身；建议把归档放在源之外", target, source)
+		}
+		say("正在压缩 %s 到 %s\n", strings.Join(sources, ", "), target)
+		result, err = client.Compress(sources, target, options)
+	}
+	if err != nil {
+		exitIfInterrupted(ctx)
+		reportError(ExitIO, "压缩失败: %v", err)
+	}
+	warnSkipped(result)
+	if jsonOutput {
+		printJSON(map[string]interface{}{
+			"operation":     "compress",
+			"target":        target,
+			"files":         result.Files,
+			"bytes":         result.Bytes,
+			"archive_bytes": result.ArchiveBytes,
+			"skipped":       result.Skipped,
+			"unchanged":     result.Unchanged,
+			"filtered":      result.Filtered,
+			"deduplicated":  result.Deduplicated,
+			"volumes":       result.Volumes,
+			"errors":        errorStrings(result.Errors),
+			"dry_run":       options.DryRun,
+		})
+	} else if options.DryRun {
+		say("预演完成: 将添加 %d 个文件，共 %d 字节，未创建归档\n", result.Files, result.Bytes)
+		if !options.Since.IsZero() {
+			say("跳过 %d 个 %s 之前修改的文件\n", result.Unchanged, options.Since.Format("2006-01-02 15:04:05"))
+		}
+		if options.MinFileSize > 0 || options.MaxFileSize > 0 {
+			say("跳过 %d 个大小不在范围内的文件\n", result.Filtered)
+		}
+	} else {
+		say("%s\n", compressionSummary(result))
+		if !options.Since.IsZero() {
+			say("跳过 %d 个 %s 之前修改的文件\n", result.Unchanged, options.Since.Format("2006-01-02 15:04:05"))
+		}
+		if options.MinFileSize > 0 || options.MaxFileSize > 0 {
+			say("跳过 %d 个大小不在范围内的文件\n", result.Filtered)
+		}
+		if result.Deduplicated > 0 {
+			say("%d 个文件与之前的文件内容相同，只存储了引用\n", result.Deduplicated)
+		}
+		if len(result.Volumes) > 1 {
+			say("共 %d 卷: %s\n", len(result.Volumes), strings.Join(result.Volumes, ", "))
+		}
+		say("✅ 压缩完成: %s\n", target)
+	}
+	exitIfErrors(result)
+}
+
+// 解压
+func runExtract(cliArgs []string) {
+	fs := newFlagSet("extract")
+	bufferSize := fs.String("buffer-size", "", "读写缓冲区大小，如 1M (默认 256K)")
+	limitRate := fs.String("limit-rate", "", "限制读写文件内容的速率（每秒字节数），如 20M，默认不限速")
+	strip := fs.Int("strip-components", 0, "去掉条目名开头的 N 级路径，层级不足的条目不解压")
+	var renames stringList
+	fs.Var(&renames, "rename", "将条目名开头的路径 OLD 替换为 NEW 再解压，格式 OLD=NEW（如 src=app），在 --strip-components 之后生效，可重复指定")
+	charset := fs.String("charset", "", "未标记 UTF-8 的条目名所用的编码，如 gbk、shift-jis")
+	preserveOwner := fs.Bool("preserve-owner", false, "恢复文件所有者（仅以 root 运行时生效）")
+	strict := fs.Bool("strict", false, "归档中有重名的条目时报错（默认改名为 name.1 等解压）")
+	dryRun := fs.Bool("dry-run", false, "只列出将要解压的文件，不写入磁盘")
+	showProgress := fs.Bool("progress", false, "在 stderr 输出进度")
+	force := fs.Bool("force", false, "覆盖已存在的文件")
+	fileMode := fs.String("mode", "", "解压出的文件一律使用此权限（八进制，如 644）")
+	noSpaceCheck := fs.Bool("no-space-check", false, "解压前不检查目标磁盘的可用空间")
+	skipExisting := fs.Bool("skip-existing", false, "跳过已存在且大小和修改时间相同的文件，覆盖其余已存在的文件，用于继续中断的解压")
+	interactive := fs.Bool("interactive", false, "遇到已存在的文件时询问是否覆盖")
+	yes := fs.Bool("yes", false, "目标文件夹不为空时不询问，直接解压")
+	atomic := fs.Bool("atomic", false, "先解压到临时文件夹，全部成功后再整个替换目标文件夹，失败时目标文件夹保持不变（临时文件夹建在目标旁边，目标是挂载点时无法替换）")
+	var jobs int
+	fs.IntVar(&jobs, "jobs", runtime.NumCPU(), "ZIP 同时解压的文件数，1 为串行解压")
+	fs.IntVar(&jobs, "threads", runtime.NumCPU(), "同 --jobs")
+	maxEntries := fs.Int("max-entries", archive.DefaultMaxEntries, "最多解压的条目数，超过时中止（防御解压炸弹），0 表示不限制")
+	maxTotalSize := fs.String("max-total-size", "64G", "解压出的内容总大小上限，如 10G，超过时中止（防御解压炸弹），0 表示不限制")
+	var verbose bool
+	fs.BoolVar(&verbose, "v", false, "输出每个解压的文件")
+	fs.BoolVar(&verbose, "verbose", false, "同 -v")
+	args := parseFlags(fs, extractUsage, cliArgs)
+
+	if len(args) < 2 {
+		reportError(ExitUsage, "参数不足: %s", extractUsage)
+	}
+
+	source := args[0]
+	target := args[1]
+
+	// 其余位置参数为条目匹配规则，只解压匹配的条目
+	options := archive.Options{
+		Patterns:        args[2:],
+		StripComponents: *strip,
+		Charset:         *charset,
+		PreserveOwner:   *preserveOwner,
+		Strict:          *strict,
+		DryRun:          *dryRun,
+		Force:           *force,
+		SkipExisting:    *skipExisting,
+		NoSpaceCheck:    *noSpaceCheck,
+		Atomic:          *atomic,
+		Jobs:            jobs,
+	}
+	if *showProgress {
+		options.OnProgress = progressPrinter(os.Stderr)
+	}
+	options.Verbose = verboseOut(verbose || *dryRun)
+	if *fileMode != "" {
+		mode, err := strconv.ParseUint(*fileMode, 8, 32)
+		if err != nil || mode == 0 || mode > 0777 {
+			reportError(ExitUsage, "无效的权限: %s，应为 1-777 的八进制数", *fileMode)
+		}
+		options.FileMode = os.FileMode(mode)
+	}
+	if options.StripComponents < 0 {
+		reportError(ExitUsage, "无效的 --strip-components: %d", options.StripComponents)
+	}
+	for _, rule := range renames {
+		i := strings.Index(rule, "=")
+		if i < 0 {
+			reportError(ExitUsage, "无效的 --rename: %s，格式应为 OLD=NEW", rule)
+		}
+		rename := archive.Rename{Old: rule[:i], New: rule[i+1:]}
+		if filepath.IsAbs(rename.New) || strings.HasPrefix(rename.New, "/") {
+			reportError(ExitUsage, "无效的 --rename: %s，NEW 不能是绝对路径", rule)
+		}
+		options.Renames = append(options.Renames, rename)
+	}
+	// 原子解压总是写入空的临时文件夹，已存在的文件无从跳过或确认
+	if options.Atomic && (options.SkipExisting || *interactive) {
+		reportError(ExitUsage, "--atomic 不能与 --skip-existing 或 --interactive 同时使用")
+	}
+	if options.Jobs < 1 {
+		reportError(ExitUsage, "无效的并行数: %d", options.Jobs)
+	}
+	// 命令行上 0 表示不限制，对应 Options 中的负数
+	switch {
+	case *maxEntries < 0:
+		reportError(ExitUsage, "无效的 --max-entries: %d", *maxEntries)
+	case *maxEntries == 0:
+		options.MaxEntries = -1
+	default:
+		options.MaxEntries = *maxEntries
+	}
+	limit, err := parseSize(*maxTotalSize)
+	if err != nil {
+		reportError(ExitUsage, "无效的 --max-total-size: %s", *maxTotalSize)
+	}
+	options.MaxTotalSize = limit
+	if limit == 0 {
+		options.MaxTotalSize = -1
+	}
+	if *interactive {
+		// 归档从标准输入读取时无法再从标准输入读取回答
+		if source == "-" {
+			reportError(ExitUsage, "从标准输入读取归档时不能使用 --interactive")
+		}
+		options.ConfirmOverwrite = confirmOverwrite
+	}
+	if options.BufferSize, err = parseBufferSize(*bufferSize); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if options.RateLimit, err = parseRateLimit(*limitRate); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	options.TempDir = tempDir
+
+	// 解压到不为空的文件夹前先确认一次；标准输入不是终端（如在脚本中运行）或用于读取归档时无法询问，不确认
+	if !*yes && !options.DryRun && source != "-" && term.IsTerminal(int(os.Stdin.Fd())) {
+		if !confirmNonEmptyTarget(target) {
+			reportError(ExitUsage, "已取消解压")
+		}
+	}
+
+	ctx := interruptContext()
+	options.Context = ctx
+
+	var result *archive.Result
+	if source == "-" {
+		// 源为 - 时从标准输入读取归档，如 curl ... | xzip extract - out/
+		say("正在解压缩 标准输入 到 %s\n", target)
+		result, err = client.ExtractReader(os.Stdin, target, options)
+	} else {
+		say("正在解压缩 %s 到 %s\n", source, target)
+		result, err = client.Extract(source, target, options)
+	}
+	if err != nil {
+		exitIfInterrupted(ctx)
+		reportError(ExitIO, "解压缩失败: %v", err)
+	}
+	for _, name := range result.Renamed {
+		logf(logWarn, "条目重名，已改名解压为: %s", name)
+	}
+	if jsonOutput {
+		printJSON(map[string]interface{}{
+			"operation": "extract",
+			"target":    target,
+			"files":     result.Files,
+			"bytes":     result.Bytes,
+			"paths":     result.Paths,
+			"matched":   result.Matched,
+			"renamed":   result.Renamed,
+			"unchanged": result.Unchanged,
+			"dry_run":   options.DryRun,
+		})
+	} else if options.DryRun {
+		say("预演完成: 将解压 %d 个文件，共 %d 字节，未写入磁盘\n", result.Files, result.Bytes)
+	} else {
+		if len(options.Patterns) > 0 {
+			say("匹配 %d 个条目，", result.Matched)
+		}
+		say("解压 %d 个文件，共 %s\n", result.Files, formatSize(result.Bytes))
+		if result.Unchanged > 0 {
+			say("跳过 %d 个已存在且未改变的文件\n", result.Unchanged)
+		}
+		say("✅ 解压缩完成: %s\n", target)
+	}
+}
+
+// 追加文件到已有归档
+func runAdd(cliArgs []string) {
+	fs := newFlagSet("add")
+	level := fs.String("level", "", "新条目的压缩级别 0-9 或 store")
+	var excludes stringList
+	fs.Var(&excludes, "exclude", "排除匹配规则的文件或目录，可重复指定")
+	bufferSize := fs.String("buffer-size", "", "读写缓冲区大小，如 1M (默认 256K)")
+	limitRate := fs.String("limit-rate", "", "限制读写文件内容的速率（每秒字节数），如 20M，默认不限速")
+	replace := fs.Bool("replace", false, "替换归档中同名的条目")
+	strict := fs.Bool("strict", false, "遇到设备文件、套接字等特殊文件时报错")
+	keepGoing := fs.Bool("keep-going", false, "跳过无法读取的文件继续追加")
+	var verbose bool
+	fs.BoolVar(&verbose, "v", false, "输出每个添加的条目")
+	fs.BoolVar(&verbose, "verbose", false, "同 -v")
+	args := parseFlags(fs, addUsage, cliArgs)
+
+	if len(args) < 2 {
+		reportError(ExitUsage, "参数不足: %s", addUsage)
+	}
+
+	target := args[0]
+	sources := args[1:]
+
+	options := archive.Options{
+		Excludes:  excludes,
+		Replace:   *replace,
+		Strict:    *strict,
+		KeepGoing: *keepGoing,
+	}
+	options.Verbose = verboseOut(verbose)
+	var err error
+	if *level != "" {
+		if options.Level, err = parseLevel(*level); err != nil {
+			reportError(ExitUsage, "%v", err)
+		}
+	}
+	if options.BufferSize, err = parseBufferSize(*bufferSize); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	if options.RateLimit, err = parseRateLimit(*limitRate); err != nil {
+		reportError(ExitUsage, "%v", err)
+	}
+	options.TempDir = tempDir
+
+	ctx := interruptContext()
+	options.Context = ctx
+
+	say("正在追加 %s 到 %s\n", strings.Join(sources, ", "), target)
+	result, err := client.Add(target, sources, options)
+	if err != nil {
+		exitIfInterrupted(ctx)
+		reportError(ExitIO, "追加失败: %v", err)
+	}
+	warnSkipped(result)
+	if jsonOutput {
+		printJSON(map[string]interface{}{
+			"operation": "add",
+			"target":    target,
+			"files":     result.Files,
+			"bytes":     result.Bytes,
+			"skipped":   result.Skipped,
+			"errors":    errorStrings(result.Errors),
+		})
+	} else {
+		say("✅ 追加完成: %s\n", target)
+	}
+	exitIfErrors(result)
+}
+
+// 列出归档内容
+func runList(cliArgs []string) {
+	fs := newFlagSet("list")
+	var long bool
+	fs.BoolVar(&long, "long", false, "同时显示 CRC32 和压缩方法")
+	fs.BoolVar(&long, "l", false, "同 --long")
+	args := parseFlags(fs, listUsage, cliArgs)
+
+	if len(args) < 1 {
+		reportError(ExitUsage, "参数不足: %s", listUsage)
+	}
+
+	if err := listZip(args[0], long); err != nil {
+		reportError(ExitIO, "列出失败: %v", err)
+	}
+}
+
+// 查看归档中单个条目的信息
+func runStat(cliArgs []string) {
+	fs := newFlagSet("stat")
+	args := parseFlags(fs, statUsage, cliArgs)
+
+	if len(args) < 2 {
+		reportError(ExitUsage, "参数不足: %s", statUsage)
+	}
+
+	if err := statZip(args[0], args[1]); err != nil {
+		reportError(ExitIO, "查看失败: %v", err)
+	}
+}
+
+// 将归档中单个文件条目的内容输出到标准输出，类似 tar -xOf
+func runCat(cliArgs []string) {
+	fs := newFlagSet("cat")
+	args := parseFlags(fs, catUsage, cliArgs)
+
+	if len(args) < 2 {
+		reportError(ExitUsage, "参数不足: %s", catUsage)
+	}
+	if jsonOutput {
+		reportError(ExitUsage, "--json 不能与 cat 同时使用")
+	}
+
+	if err := catZip(args[0], args[1], os.Stdout); err != nil {
+		reportError(ExitIO, "输出失败: %v", err)
+	}
+}
+
+// 校验归档中每个文件的 CRC32
+func runTest(cliArgs []string) {
+	fs := newFlagSet("test")
+	args := parseFlags(fs, testUsage, cliArgs)
+
+	if len(args) < 1 {
+		reportError(ExitUsage, "参数不足: %s", testUsage)
+	}
+
+	results, err := client.Verify(args[0])
+	if err != nil {
+		reportError(ExitIO, "校验失败: %v", err)
+	}
+
+	failed := []map[string]string{}
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, map[string]string{"name": result.Name, "error": result.Err.Error()})
+			say("❌ %s: %v\n", result.Name, result.Err)
+		} else {
+			say("  OK  %s\n", result.Name)
+		}
+	}
+
+	if jsonOutput {
+		printJSON(map[string]interface{}{
+			"operation": "test",
+			"files":     len(results),
+			"failed":    failed,
+		})
+		if len(failed) > 0 {
+			os.Exit(ExitVerify)
+		}
+		return
+	}
+
+	if len(failed) > 0 {
+		reportError(ExitVerify, "共 %d 个文件，%d 个校验失败", len(results), len(failed))
 	}
+	say("✅ 共 %d 个文件，全部校验通过\n", len(results))
 }
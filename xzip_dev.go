@@ -0,0 +1,14 @@
+//go:build dev
+
+// 开发构建，允许用 XZIP_SKIP_AUTH=1 跳过授权验证:
+//
+//	go build -tags dev -o xzip-dev xzip.go xzip_dev.go
+//
+// 发布构建只编译 xzip.go，不包含此文件，授权验证无法跳过。
+
+package main
+
+func init() {
+	devBuild = true
+	version += "-dev"
+}
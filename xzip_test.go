@@ -0,0 +1,141 @@
+package main
+
+// 根目录下的 server.go 也属于 main 包，需要只编译 xzip.go 运行这些测试:
+//
+//	go test xzip.go xzip_test.go
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 以 --key-file 指定的文件读取key，测试结束后恢复
+func useKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := keyFileFlag
+	keyFileFlag = path
+	t.Cleanup(func() { keyFileFlag = old })
+	return path
+}
+
+func TestReadAuthKeyEmptyFile(t *testing.T) {
+	for _, content := range []string{"", "  \n\t\n"} {
+		path := useKeyFile(t, content)
+		key, err := readAuthKey()
+		if err == nil {
+			t.Fatalf("key文件内容为 %q 时应当报错，得到 %q", content, key)
+		}
+		for _, want := range []string{path, "为空", "xzip auth set"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("错误信息应当包含 %q: %v", want, err)
+			}
+		}
+	}
+}
+
+func TestReadAuthKeyTrimsSpace(t *testing.T) {
+	useKeyFile(t, "  abc123\n")
+	key, err := readAuthKey()
+	if err != nil || key != "abc123" {
+		t.Fatalf("readAuthKey() = %q, %v", key, err)
+	}
+}
+
+// 记录收到的请求的代理服务器，返回其地址和收到的请求 URL
+func startTestProxy(t *testing.T) (*url.URL, chan string) {
+	t.Helper()
+	requests := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.String()
+		w.Write([]byte("via proxy"))
+	}))
+	t.Cleanup(proxy.Close)
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxyURL, requests
+}
+
+// 经由 client 请求一个不存在的主机，只有经过代理才能得到响应
+func getViaProxy(t *testing.T, client *http.Client, requests chan string) {
+	t.Helper()
+	const target = "http://auth.xzip.invalid/api/auth"
+	resp, err := client.Get(target)
+	if err != nil {
+		t.Fatalf("请求没有经过代理: %v", err)
+	}
+	resp.Body.Close()
+	select {
+	case got := <-requests:
+		if got != target {
+			t.Fatalf("代理收到的请求为 %s，应为 %s", got, target)
+		}
+	default:
+		t.Fatal("代理没有收到请求")
+	}
+}
+
+// 没有指定 --proxy 时按 HTTP_PROXY 等环境变量使用代理
+// 标准库只在第一次使用时读取这些环境变量，本文件中其他测试不应在此之前发出请求
+func TestAuthClientProxyFromEnvironment(t *testing.T) {
+	proxyURL, requests := startTestProxy(t)
+	t.Setenv("HTTP_PROXY", proxyURL.String())
+	t.Setenv("NO_PROXY", "")
+	getViaProxy(t, authClient(5*time.Second), requests)
+}
+
+func TestAuthClientProxyFlag(t *testing.T) {
+	proxyURL, requests := startTestProxy(t)
+	old := authProxy
+	authProxy = proxyURL
+	defer func() { authProxy = old }()
+	getViaProxy(t, authClient(5*time.Second), requests)
+}
+
+// 收到 Ctrl-C 时取消 context
+func TestInterruptContext(t *testing.T) {
+	ctx := interruptContext()
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("无法向自身发送中断信号: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("收到中断信号后 context 没有取消")
+	}
+}
+
+// 操作被中断时以 ExitInterrupted 退出；在子进程中运行，以检查退出码
+func TestExitIfInterrupted(t *testing.T) {
+	if os.Getenv("XZIP_TEST_INTERRUPTED") == "1" {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		exitIfInterrupted(ctx)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitIfInterrupted$")
+	cmd.Env = append(os.Environ(), "XZIP_TEST_INTERRUPTED=1")
+	err := cmd.Run()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != ExitInterrupted {
+		t.Fatalf("应以 %d 退出，得到 %v", ExitInterrupted, err)
+	}
+}